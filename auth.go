@@ -0,0 +1,130 @@
+package gee
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AuthUserKey 认证通过的用户保存在 Context.Keys 中的键。
+// BasicAuth 保存用户名, BearerAuth 保存 validator 的返回值
+const AuthUserKey = "gee.user"
+
+const defaultRealm = "Authorization Required"
+
+// Accounts 用户名到密码的映射
+type Accounts map[string]string
+
+// basicAccount 预先计算好摘要的账号, 比较摘要可以避免通过比较时间推测出用户名和密码的长度
+type basicAccount struct {
+	user     string
+	userHash [sha256.Size]byte
+	passHash [sha256.Size]byte
+}
+
+// BasicAuth HTTP Basic 认证中间件, 使用默认的 realm
+func BasicAuth(accounts Accounts) HandlerFunc {
+	return BasicAuthForRealm(accounts, "")
+}
+
+// BasicAuthForRealm HTTP Basic 认证中间件, 用户名和密码使用常量时间比较。
+// 认证通过时用户名保存在 Keys[AuthUserKey] 中, 否则返回 401 以及 WWW-Authenticate 质询
+func BasicAuthForRealm(accounts Accounts, realm string) HandlerFunc {
+	if len(accounts) == 0 {
+		panic("[GEE] basic auth accounts is empty")
+	}
+	if realm == "" {
+		realm = defaultRealm
+	}
+	list := make([]basicAccount, 0, len(accounts))
+	for user, pass := range accounts {
+		if user == "" {
+			panic("[GEE] basic auth user can not be empty")
+		}
+		list = append(list, basicAccount{user: user, userHash: sha256.Sum256([]byte(user)), passHash: sha256.Sum256([]byte(pass))})
+	}
+	challenge := "Basic realm=" + strconv.Quote(realm) + `, charset="UTF-8"`
+
+	return func(c *Context) {
+		user, ok := searchAccount(list, c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithJson(http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+		c.Set(AuthUserKey, user)
+		c.Next()
+	}
+}
+
+// searchAccount 解析 Basic 认证头并查找匹配的账号, 总是比较所有账号
+func searchAccount(list []basicAccount, header string) (user string, ok bool) {
+	const prefix = "Basic "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[len(prefix):]))
+	if err != nil {
+		return
+	}
+	name, pass, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return
+	}
+
+	nameHash, passHash := sha256.Sum256([]byte(name)), sha256.Sum256([]byte(pass))
+	for _, a := range list {
+		match := subtle.ConstantTimeCompare(nameHash[:], a.userHash[:]) &
+			subtle.ConstantTimeCompare(passHash[:], a.passHash[:])
+		if match == 1 {
+			user, ok = a.user, true
+		}
+	}
+	return
+}
+
+// BearerAuth Bearer Token 认证中间件, 使用默认的 realm
+func BearerAuth(validator func(token string) (any, error)) HandlerFunc {
+	return BearerAuthForRealm(validator, "")
+}
+
+// BearerAuthForRealm Bearer Token 认证中间件, validator 校验 token 并返回认证的主体,
+// 返回值保存在 Keys[AuthUserKey] 中。按照 RFC 6750 返回质询:
+// 没有携带 Bearer 认证信息时返回 401 和不带错误码的质询, token 为空时返回 400 和 invalid_request,
+// validator 返回错误时返回 401 和 invalid_token
+func BearerAuthForRealm(validator func(token string) (any, error), realm string) HandlerFunc {
+	if validator == nil {
+		panic("[GEE] bearer auth validator is nil")
+	}
+	if realm == "" {
+		realm = defaultRealm
+	}
+	challenge := "Bearer realm=" + strconv.Quote(realm)
+
+	return func(c *Context) {
+		scheme, token, _ := strings.Cut(strings.TrimSpace(c.GetHeader("Authorization")), " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			// 没有携带 Bearer 认证信息
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithJson(http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+		if token = strings.TrimSpace(token); token == "" {
+			c.Header("WWW-Authenticate", challenge+`, error="invalid_request"`)
+			c.AbortWithJson(http.StatusBadRequest, "invalid authorization header")
+			return
+		}
+
+		subject, err := validator(token)
+		if err != nil {
+			c.Header("WWW-Authenticate", challenge+`, error="invalid_token"`)
+			c.AbortWithJson(http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+		c.Set(AuthUserKey, subject)
+		c.Next()
+	}
+}
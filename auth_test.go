@@ -0,0 +1,86 @@
+package gee
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	r := Default(WithReleaseMode(true), WithMiddlewares(BasicAuthForRealm(Accounts{"admin": "secret", "ops": "pwd"}, `internal "tools"`)))
+	r.GET("/admin", func(c *Context) {
+		c.String(http.StatusOK, c.GetString(AuthUserKey))
+	})
+
+	tests := []struct {
+		user, pass string
+		set        bool
+		code       int
+	}{
+		{"admin", "secret", true, http.StatusOK},
+		{"ops", "pwd", true, http.StatusOK},
+		{"admin", "pwd", true, http.StatusUnauthorized},
+		{"nobody", "secret", true, http.StatusUnauthorized},
+		{"", "", false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if tt.set {
+			req.SetBasicAuth(tt.user, tt.pass)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("%s:%s status = %d, want %d", tt.user, tt.pass, w.Code, tt.code)
+			continue
+		}
+		if tt.code == http.StatusOK && w.Body.String() != tt.user {
+			t.Errorf("authenticated user should be %q, got %q", tt.user, w.Body.String())
+		}
+		if want := `Basic realm="internal \"tools\"", charset="UTF-8"`; tt.code != http.StatusOK && w.Header().Get("WWW-Authenticate") != want {
+			t.Errorf("challenge = %q, want %q", w.Header().Get("WWW-Authenticate"), want)
+		}
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	type claims struct{ Subject string }
+	r := Default(WithReleaseMode(true), WithMiddlewares(BearerAuth(func(token string) (any, error) {
+		if token != "good-token" {
+			return nil, errors.New("expired")
+		}
+		return claims{Subject: "svc"}, nil
+	})))
+	r.GET("/api", func(c *Context) {
+		v, _ := Value[claims](c, AuthUserKey)
+		c.String(http.StatusOK, v.Subject)
+	})
+
+	tests := []struct {
+		header    string
+		code      int
+		challenge string
+	}{
+		{"Bearer good-token", http.StatusOK, ""},
+		{"bearer good-token", http.StatusOK, ""},
+		{"", http.StatusUnauthorized, `Bearer realm="Authorization Required"`},
+		{"Basic YTpi", http.StatusUnauthorized, `Bearer realm="Authorization Required"`},
+		{"Bearer ", http.StatusBadRequest, `Bearer realm="Authorization Required", error="invalid_request"`},
+		{"Bearer bad-token", http.StatusUnauthorized, `Bearer realm="Authorization Required", error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code || w.Header().Get("WWW-Authenticate") != tt.challenge {
+			t.Errorf("%q: status = %d, challenge = %q", tt.header, w.Code, w.Header().Get("WWW-Authenticate"))
+		}
+		if tt.code == http.StatusOK && w.Body.String() != "svc" {
+			t.Errorf("%q: subject should be stored in keys, body = %q", tt.header, w.Body.String())
+		}
+	}
+}
@@ -41,6 +41,19 @@ type Validator struct {
 	*validator.Validate
 }
 
+// NewValidator 创建一个独立的校验器, 使用 binding 标签。
+// 与 ValidatorTol 不同, 它不会开启 Bind 时的全局校验
+func NewValidator() *Validator {
+	v := &Validator{Validate: validator.New()}
+	v.setTagName()
+	return v
+}
+
+// ValidateStruct 使用 binding 标签校验 obj, 只对结构体, 结构体指针以及它们的切片生效
+func (v *Validator) ValidateStruct(obj any) error {
+	return v.validate(obj)
+}
+
 func validate(obj any) error {
 	if validatorTol == nil {
 		return nil
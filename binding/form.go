@@ -29,6 +29,25 @@ func (formBinding) Bind(req *http.Request, obj any) error {
 
 // BindForm 通过反射来绑定参数
 func BindForm(req *http.Request, obj interface{}) error {
+	return mapForm(obj, req.Form, "form")
+}
+
+// BindQuery 只绑定 URL 中的查询参数, 使用 form 标签
+func BindQuery(req *http.Request, obj any) error {
+	return mapForm(obj, req.URL.Query(), "form")
+}
+
+// BindUri 绑定路径参数, 使用 uri 标签, 比如 /user/:id 对应 `uri:"id"`
+func BindUri(params map[string]string, obj any) error {
+	form := make(map[string][]string, len(params))
+	for k, v := range params {
+		form[k] = []string{v}
+	}
+	return mapForm(obj, form, "uri")
+}
+
+// mapForm 通过反射将 form 中的值绑定到 obj 中 tag 标签对应的字段
+func mapForm(obj any, form map[string][]string, tagName string) error {
 	// 获取结构体类型和值
 	objType := reflect.TypeOf(obj).Elem()
 	objValue := reflect.ValueOf(obj).Elem()
@@ -36,7 +55,7 @@ func BindForm(req *http.Request, obj interface{}) error {
 	// 遍历结构体的字段
 	for i := 0; i < objType.NumField(); i++ {
 		field := objType.Field(i)
-		tag := field.Tag.Get("form")
+		tag := field.Tag.Get(tagName)
 
 		// 如果tag为 '-' 或者 该字段为私有字段，则跳过该字段
 		if tag == "-" || !field.IsExported() {
@@ -46,23 +65,22 @@ func BindForm(req *http.Request, obj interface{}) error {
 		// 将参数值转换为字段类型
 		fieldType := field.Type
 		fieldValue := objValue.Field(i)
-		// 从req.Form中获取参数值 如果获取不到就跳过
-		values, ok := req.Form[tag]
+		// 从form中获取参数值 如果获取不到就跳过
+		values, ok := form[tag]
 		if !ok {
-			// 处理嵌套结构体 使用一个新的结构体来进入递归。
-			// 将新结构体中的字段 赋值 给旧结构体。
+			// 处理嵌套结构体 直接在原有的字段上进入递归,
+			// 这样多次从不同来源绑定时不会覆盖已经绑定好的值。
 			if fieldType.Kind() == reflect.Struct {
-				nestedObj := reflect.New(fieldType).Interface()
-				if err := BindForm(req, nestedObj); err != nil {
+				if err := mapForm(fieldValue.Addr().Interface(), form, tagName); err != nil {
 					return err
 				}
-				objValue.Field(i).Set(reflect.ValueOf(nestedObj).Elem())
 			} else if fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Struct {
-				nestedObj := reflect.New(fieldType.Elem()).Interface()
-				if err := BindForm(req, nestedObj); err != nil {
+				if fieldValue.IsNil() {
+					fieldValue.Set(reflect.New(fieldType.Elem()))
+				}
+				if err := mapForm(fieldValue.Interface(), form, tagName); err != nil {
 					return err
 				}
-				objValue.Field(i).Set(reflect.ValueOf(nestedObj).Elem().Addr())
 			}
 			continue
 		}
@@ -74,7 +92,7 @@ func BindForm(req *http.Request, obj interface{}) error {
 			for j, value := range values {
 				sliceValue, err := convertValue(value, sliceType)
 				if err != nil {
-					return fmt.Errorf("invalid form parameter: %s", tag)
+					return fmt.Errorf("invalid %s parameter: %s", tagName, tag)
 				}
 				slice.Index(j).Set(sliceValue)
 			}
@@ -83,7 +101,7 @@ func BindForm(req *http.Request, obj interface{}) error {
 			// 否则直接转换为字段类型
 			rftVal, err := convertValue(values[0], fieldType)
 			if err != nil {
-				return fmt.Errorf("invalid form parameter: %s", tag)
+				return fmt.Errorf("invalid %s parameter: %s", tagName, tag)
 			}
 			fieldValue.Set(rftVal)
 		}
@@ -0,0 +1,307 @@
+package gee
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	GzipEncoding    = "gzip"
+	DeflateEncoding = "deflate"
+
+	defaultCompressMinLength = 1024
+)
+
+// defaultExcludedContentTypes 默认不压缩的响应类型, 这些格式本身已经压缩过
+var defaultExcludedContentTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+	"video/", "audio/", "font/woff",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"application/x-bzip2", "application/x-7z-compressed", "application/x-rar-compressed", "application/pdf",
+}
+
+// CompressConfig 响应压缩中间件的配置
+type CompressConfig struct {
+	// Level 压缩级别, 与 compress/flate 相同, 一般使用 flate.DefaultCompression;
+	// 为 0 即 flate.NoCompression 时只进行编码封装不压缩
+	Level int
+	// MinLength 小于该字节数的响应不压缩, 为 0 时使用 1024
+	MinLength int
+	// Encodings 支持的编码, 按照优先级排列, 为空时使用 gzip, deflate
+	Encodings []string
+	// ExcludedContentTypes 不压缩的响应类型前缀, 为空时使用 defaultExcludedContentTypes
+	ExcludedContentTypes []string
+}
+
+// Gzip 使用 gzip 压缩响应, level 与 compress/gzip 相同, gzip.NoCompression 时只进行 gzip 封装不压缩
+func Gzip(level int) HandlerFunc {
+	return CompressWithConfig(CompressConfig{Level: level, Encodings: []string{GzipEncoding}})
+}
+
+// Deflate 使用 deflate 压缩响应, level 与 compress/flate 相同, flate.NoCompression 时只进行 deflate 封装不压缩
+func Deflate(level int) HandlerFunc {
+	return CompressWithConfig(CompressConfig{Level: level, Encodings: []string{DeflateEncoding}})
+}
+
+// CompressWithConfig 根据配置创建响应压缩中间件。
+// 根据 Accept-Encoding 选择编码并设置 Vary, 响应体小于 MinLength, 已经设置了 Content-Encoding
+// 或者属于已压缩的类型时不压缩; 压缩时删除 Content-Length。
+// 调用 Flush 时立即开始压缩并将已压缩的数据发送给客户端, 因此可以用于流式响应和 SSE
+func CompressWithConfig(conf CompressConfig) HandlerFunc {
+	if conf.MinLength <= 0 {
+		conf.MinLength = defaultCompressMinLength
+	}
+	if len(conf.Encodings) == 0 {
+		conf.Encodings = []string{GzipEncoding, DeflateEncoding}
+	}
+	if len(conf.ExcludedContentTypes) == 0 {
+		conf.ExcludedContentTypes = defaultExcludedContentTypes
+	}
+
+	pools := make(map[string]*sync.Pool, len(conf.Encodings))
+	for _, enc := range conf.Encodings {
+		enc := strings.ToLower(enc)
+		if _, err := newCompressor(enc, io.Discard, conf.Level); err != nil {
+			panic("[GEE] compress " + enc + ": " + err.Error())
+		}
+		pools[enc] = &sync.Pool{New: func() any {
+			w, _ := newCompressor(enc, io.Discard, conf.Level)
+			return w
+		}}
+	}
+
+	return func(c *Context) {
+		if c.Method == http.MethodHead || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+		addVary(c.Writer.Header(), "Accept-Encoding")
+		enc := negotiateEncoding(c.GetHeader("Accept-Encoding"), conf.Encodings)
+		if enc == "" {
+			c.Next()
+			return
+		}
+
+		orig := c.Writer
+		cw := &compressWriter{ResponseWriter: orig, encoding: enc, pool: pools[enc], conf: &conf}
+		c.Writer = cw
+		defer func() {
+			c.Writer = orig
+			cw.close()
+		}()
+		c.Next()
+		cw.finish()
+	}
+}
+
+// compressor gzip.Writer 和 flate.Writer 的共同方法
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+func newCompressor(encoding string, w io.Writer, level int) (compressor, error) {
+	if encoding == GzipEncoding {
+		return gzip.NewWriterLevel(w, level)
+	}
+	if encoding == DeflateEncoding {
+		return flate.NewWriter(w, level)
+	}
+	return nil, errors.New("unsupported encoding")
+}
+
+// negotiateEncoding 根据 Accept-Encoding 的 q 值选择 supported 中的编码, q 值相同时按照 supported 的顺序
+func negotiateEncoding(accept string, supported []string) string {
+	if accept == "" {
+		return ""
+	}
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if f, err := strconv.ParseFloat(params[2:], 64); err == nil {
+				q = f
+			}
+		}
+		qs[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range supported {
+		enc = strings.ToLower(enc)
+		q, ok := qs[enc]
+		if !ok {
+			q, ok = qs["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// addVary 向 Vary 中添加 value, 已经存在时不重复添加
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, token := range strings.Split(v, ",") {
+			if t := strings.TrimSpace(token); t == "*" || strings.EqualFold(t, value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+// compressWriter 缓冲响应的开头部分以决定是否压缩, 决定之后直接写入压缩器或者原始的 Writer
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	pool     *sync.Pool
+	conf     *CompressConfig
+
+	status  int
+	buf     []byte
+	decided bool
+	cw      compressor // 为空时不压缩
+}
+
+var (
+	_ http.Flusher  = &compressWriter{}
+	_ http.Hijacker = &compressWriter{}
+)
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status == 0 && !w.decided {
+		w.status = code
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.conf.MinLength {
+			return len(data), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.cw != nil {
+		return w.cw.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush 立即决定是否压缩, 将缓冲和压缩器中的数据发送给客户端
+func (w *compressWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		if w.decide(true) != nil {
+			return
+		}
+	}
+	if w.cw != nil {
+		_ = w.cw.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, ErrNotHijacker
+	}
+	return h.Hijack()
+}
+
+// Written 是否已经写回了响应头, 响应可能还在缓冲中没有发送给客户端
+func (w *compressWriter) Written() bool {
+	return w.status != 0
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish 处理链结束之后写回还在缓冲中的响应, 此时数据不足 MinLength, 不压缩
+func (w *compressWriter) finish() {
+	if w.decided || w.status == 0 {
+		return
+	}
+	_ = w.decide(false)
+}
+
+// close 结束压缩并将压缩器放回池中
+func (w *compressWriter) close() {
+	if w.cw == nil {
+		return
+	}
+	_ = w.cw.Close()
+	w.cw.Reset(io.Discard)
+	w.pool.Put(w.cw)
+	w.cw = nil
+}
+
+// decide 决定是否压缩并写回响应头和缓冲的数据
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	h := w.Header()
+	if compress && len(w.buf) > 0 && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if compress && w.shouldCompress(h) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		w.cw = w.pool.Get().(compressor)
+		w.cw.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.cw != nil {
+		_, err = w.cw.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *compressWriter) shouldCompress(h http.Header) bool {
+	switch {
+	case w.status < http.StatusOK, w.status == http.StatusNoContent,
+		w.status == http.StatusPartialContent, w.status == http.StatusNotModified:
+		return false
+	case h.Get("Content-Encoding") != "":
+		return false
+	}
+	ct := strings.ToLower(h.Get("Content-Type"))
+	for _, t := range w.conf.ExcludedContentTypes {
+		if strings.HasPrefix(ct, t) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package gee
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{GzipEncoding, DeflateEncoding}
+	tests := map[string]string{
+		"":                          "",
+		"gzip, deflate, br":         GzipEncoding,
+		"deflate":                   DeflateEncoding,
+		"gzip;q=0.5, deflate;q=0.8": DeflateEncoding,
+		"gzip;q=0, *":               DeflateEncoding,
+		"identity":                  "",
+		"*;q=0":                     "",
+	}
+	for accept, want := range tests {
+		if got := negotiateEncoding(accept, supported); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	big := strings.Repeat("gee compress ", 200)
+	r := Default(WithReleaseMode(true), WithMiddlewares(CompressWithConfig(CompressConfig{Level: flate.DefaultCompression})))
+	r.GET("/big", func(c *Context) {
+		c.Header("Content-Length", "2600")
+		c.String(http.StatusOK, big)
+	})
+	r.GET("/small", func(c *Context) {
+		c.String(http.StatusOK, "small")
+	})
+	r.GET("/png", func(c *Context) {
+		c.Header("Content-Type", "image/png")
+		c.Status(http.StatusOK)
+		_, _ = io.WriteString(c.Writer, big)
+	})
+
+	do := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/big", "gzip")
+	if w.Header().Get("Content-Encoding") != GzipEncoding || w.Header().Get("Content-Length") != "" ||
+		w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("response should be gzipped, header = %v", w.Header())
+	}
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(gr); string(body) != big {
+		t.Fatalf("unexpected gzip body: %q", body)
+	}
+
+	w = do("/big", "deflate")
+	if body, _ := io.ReadAll(flate.NewReader(w.Body)); w.Header().Get("Content-Encoding") != DeflateEncoding || string(body) != big {
+		t.Fatalf("response should be deflated, header = %v", w.Header())
+	}
+
+	for _, path := range []string{"/small", "/png"} {
+		w = do(path, "gzip")
+		if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("%s should not be compressed, header = %v", path, w.Header())
+		}
+	}
+	if w = do("/small", "gzip"); w.Body.String() != "small" {
+		t.Fatalf("small body should be written as is: %q", w.Body.String())
+	}
+	if w = do("/big", ""); w.Body.String() != big || w.Header().Get("Content-Length") != "2600" {
+		t.Fatalf("response without Accept-Encoding should not be compressed, header = %v", w.Header())
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	next := make(chan struct{})
+	r := Default(WithReleaseMode(true), WithMiddlewares(Gzip(gzip.BestSpeed)))
+	r.GET("/events", func(c *Context) {
+		c.Header("Content-Type", "text/event-stream")
+		for i := 0; i < 2; i++ {
+			_, _ = io.WriteString(c.Writer, "data: ping\n\n")
+			c.Writer.(http.Flusher).Flush()
+			<-next
+		}
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != GzipEncoding {
+		t.Fatalf("event stream should be gzipped, header = %v", resp.Header)
+	}
+
+	// 处理函数还没有结束时就能读到已经 Flush 的事件
+	gr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(gr)
+	for i := 0; i < 2; i++ {
+		line, err := br.ReadString('\n')
+		if err != nil || line != "data: ping\n" {
+			t.Fatalf("event %d: %q, %v", i, line, err)
+		}
+		_, _ = br.ReadString('\n')
+		next <- struct{}{}
+	}
+}
+
+func TestCompressLevel(t *testing.T) {
+	big := strings.Repeat("gee compress ", 200)
+	do := func(h HandlerFunc) *httptest.ResponseRecorder {
+		r := Default(WithReleaseMode(true), WithMiddlewares(h))
+		r.GET("/big", func(c *Context) {
+			c.String(http.StatusOK, big)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/big", nil)
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 所有入口的 level 都与 compress/flate 相同, NoCompression 时数据以未压缩的块保存
+	for _, h := range []HandlerFunc{Gzip(gzip.NoCompression), Deflate(flate.NoCompression), CompressWithConfig(CompressConfig{})} {
+		if w := do(h); !strings.Contains(w.Body.String(), big) {
+			t.Fatalf("%s with NoCompression should store data as is, size = %d", w.Header().Get("Content-Encoding"), w.Body.Len())
+		}
+	}
+	for _, h := range []HandlerFunc{Gzip(gzip.DefaultCompression), CompressWithConfig(CompressConfig{Level: flate.DefaultCompression})} {
+		if w := do(h); w.Body.Len() >= len(big)/2 {
+			t.Fatalf("default level should compress, size = %d", w.Body.Len())
+		}
+	}
+}
+
+func TestCompressRecover(t *testing.T) {
+	r := Default(WithReleaseMode(true), WithMiddlewares(Gzip(gzip.DefaultCompression), Recover()))
+	r.GET("/panic", func(c *Context) {
+		c.String(http.StatusOK, "partial")
+		panic("boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	// 响应已经写入压缩中间件的缓冲区, Recover 不能再追加错误响应
+	if w.Code != http.StatusOK || w.Body.String() != "partial" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("status = %d, body = %q, header = %v", w.Code, w.Body.String(), w.Header())
+	}
+}
@@ -1,15 +1,27 @@
 package gee
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/ws-cczj/gee/binding"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 )
 
-const abortLen = 1 << 10
+const (
+	abortLen    = 1 << 10
+	maxForwards = 10 // 单个请求内部转发的最大次数
+)
+
+var ErrUnsafePath = errors.New("[GEE] unsafe file path")
 
 type H map[string]any
 
@@ -23,8 +35,12 @@ type Context struct {
 	Method     string
 	StatusCode int
 
+	fullPath string // 匹配到的路由, 比如 /p/:id
+
 	index    int           // 控制当前处理进度
 	handlers []HandlerFunc // 存储当前请求对应的 中间件 和 handler.
+	forwards int           // 当前请求已经内部转发的次数
+	visited  []string      // 内部转发之前经过的路径
 
 	// This mutex protects Keys map.
 	mu sync.RWMutex
@@ -32,12 +48,17 @@ type Context struct {
 	// Keys is a key/value pair exclusively for the context of each request.
 	Keys map[string]any
 
-	engine *Engine // 存储引擎
+	engine *Engine         // 存储引擎
+	rw     *responseWriter // 最底层的 Writer, 中间件替换 Writer 之后仍然可以通过它得到写回的数据大小
 }
 
+var _ context.Context = &Context{}
+
 func newContext(w http.ResponseWriter, r *http.Request) *Context {
+	rw := newResponseWriter(w)
 	return &Context{
-		Writer: w,
+		Writer: rw,
+		rw:     rw,
 		Req:    r,
 		Params: map[string]string{},
 		Path:   r.URL.Path,
@@ -46,6 +67,38 @@ func newContext(w http.ResponseWriter, r *http.Request) *Context {
 	}
 }
 
+// Copy 返回当前上下文的只读快照，用于在 goroutine 中安全地使用上下文。
+// 快照中的 Keys、Params 和请求都是独立的副本，不包含 Writer 和处理链，
+// 因此不能通过快照写回响应，请求结束之后原上下文的变化也不会影响快照。
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		fullPath:   c.fullPath,
+		Path:       c.Path,
+		Method:     c.Method,
+		StatusCode: c.StatusCode,
+		index:      abortLen,
+		engine:     c.engine,
+	}
+	if c.Req != nil {
+		cp.Req = c.Req.Clone(c.Req.Context())
+	}
+
+	cp.Params = make(map[string]string, len(c.Params))
+	for k, v := range c.Params {
+		cp.Params[k] = v
+	}
+
+	c.mu.RLock()
+	if c.Keys != nil {
+		cp.Keys = make(map[string]any, len(c.Keys))
+		for k, v := range c.Keys {
+			cp.Keys[k] = v
+		}
+	}
+	c.mu.RUnlock()
+	return cp
+}
+
 // Next 请求处理中枢
 func (c *Context) Next() {
 	c.index++
@@ -92,10 +145,26 @@ func (c *Context) GetHeader(key string) string {
 	return c.Req.Header.Get(key)
 }
 
+// log 返回引擎的日志, 没有引擎时使用默认日志
+func (c *Context) log() Log {
+	if c.engine == nil {
+		return defaultLog
+	}
+	return c.engine.logger
+}
+
+// BodySize 返回已经写回客户端的响应体字节数
+func (c *Context) BodySize() int {
+	if c.rw == nil {
+		return 0
+	}
+	return c.rw.size
+}
+
 // Status 修改状态码
 func (c *Context) Status(code int) {
 	if c.StatusCode > 0 && c.StatusCode != code {
-		_, _ = fmt.Fprintf(os.Stdout, "[WARNING] Headers were already written. Wanted to override status code %d with %d", c.StatusCode, code)
+		c.log().Warn("headers were already written", "status", c.StatusCode, "override", code)
 	}
 	c.StatusCode = code
 	c.Writer.WriteHeader(code)
@@ -117,6 +186,11 @@ func (c *Context) String(code int, format string, v ...any) {
 // JSON 这里无法规避掉错误，因为 Header 和 Status 已经被设置完毕，即使错误
 // 也无法修改掉状态码和响应头。因此应该直接 panic
 func (c *Context) JSON(code int, obj ...any) {
+	c.renderJSON(code, obj)
+}
+
+// renderJSON 将 obj 本身编码为 JSON 写回, 不会像 JSON 一样包装为数组
+func (c *Context) renderJSON(code int, obj any) {
 	c.Header("Content-Type", "application/json;charset=utf-8")
 	c.Status(code)
 	encoder := json.NewEncoder(c.Writer)
@@ -135,6 +209,37 @@ func (c *Context) HTML(code int, suffixType string, data any) {
 	}
 }
 
+// Redirect 重定向到 location, code 只能为 3xx 或者 201
+func (c *Context) Redirect(code int, location string) {
+	if (code < http.StatusMultipleChoices || code > http.StatusPermanentRedirect) && code != http.StatusCreated {
+		panic(fmt.Sprintf("[GEE] | Cannot redirect with status code %d", code))
+	}
+	c.StatusCode = code
+	http.Redirect(c.Writer, c.Req, location, code)
+}
+
+// Forward 将请求路径改写为 path 并重新交给路由处理, 客户端不会感知到这次跳转。
+// 转发之前已经执行过的分组中间件(比如根分组上的 Logger)不会再次执行, 只有 path 新匹配到的分组中间件和路由处理函数会执行;
+// 当前处理链中剩余的处理函数不会再执行, 转发次数超过 maxForwards 时返回 508
+func (c *Context) Forward(path string) {
+	if c.forwards >= maxForwards {
+		c.AbortWithJson(http.StatusLoopDetected, "forward loop detected")
+		return
+	}
+	c.forwards++
+	c.visited = append(c.visited, c.Path)
+
+	c.Req.URL.Path = path
+	c.Req.URL.RawPath = ""
+	c.Path = path
+	c.Params = map[string]string{}
+	c.fullPath = ""
+	c.handlers = nil
+	c.index = -1
+	c.engine.handleContext(c)
+	c.Abort()
+}
+
 func (c *Context) Data(code int, data []byte) {
 	c.Status(code)
 	_, _ = c.Writer.Write(data)
@@ -148,10 +253,91 @@ func (c *Context) Query(key string) string {
 	return c.Req.URL.Query().Get(key)
 }
 
+// FullPath 返回匹配到的路由, 比如 /user/:id, 没有匹配到时返回 ""
+func (c *Context) FullPath() string {
+	return c.fullPath
+}
+
 func (c *Context) Param(key string) string {
 	return c.Params[key]
 }
 
+// MultipartForm 解析 multipart 表单, 内存中最多保存 Engine 设置的 maxMultipartMemory 字节,
+// 超出部分会写入磁盘临时文件, 请求结束后由 Engine 负责清理
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	maxMemory := int64(defaultMultipartMemory)
+	if c.engine != nil && c.engine.maxMultipartMemory > 0 {
+		maxMemory = c.engine.maxMultipartMemory
+	}
+	if err := c.Req.ParseMultipartForm(maxMemory); err != nil {
+		return nil, err
+	}
+	return c.Req.MultipartForm, nil
+}
+
+// FormFile 获取表单中 name 对应的第一个上传文件
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	if c.Req.MultipartForm == nil {
+		if _, err := c.MultipartForm(); err != nil {
+			return nil, err
+		}
+	}
+	f, fh, err := c.Req.FormFile(name)
+	if err != nil {
+		return nil, err
+	}
+	_ = f.Close()
+	return fh, nil
+}
+
+// SaveUploadedFile 将上传文件保存到 dst。如果 dst 是已存在的目录，则使用上传文件的文件名保存在该目录下。
+// dst 中不允许出现 .. 路径段，避免文件被写到预期目录之外
+func (c *Context) SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	if fh == nil {
+		return http.ErrMissingFile
+	}
+	if dst == "" || hasDotDot(dst) {
+		return ErrUnsafePath
+	}
+	dst = filepath.Clean(dst)
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		// 客户端提供的文件名不可信, 只保留最后一段
+		name := filepath.Base(strings.ReplaceAll(fh.Filename, "\\", "/"))
+		if name == "." || name == "/" || name == ".." {
+			return ErrUnsafePath
+		}
+		dst = filepath.Join(dst, name)
+	}
+
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	return err
+}
+
+// hasDotDot 判断路径中是否包含 .. 路径段
+func hasDotDot(p string) bool {
+	for _, part := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
 // Set 通过上下文传递信息
 func (c *Context) Set(key string, val any) {
 	c.mu.Lock()
@@ -171,11 +357,148 @@ func (c *Context) Get(key string) (val any, exist bool) {
 	return
 }
 
+// MustGet 获取 key 对应的值, 不存在时 panic
+func (c *Context) MustGet(key string) any {
+	if val, exist := c.Get(key); exist {
+		return val
+	}
+	panic("[GEE] | Key \"" + key + "\" does not exist")
+}
+
+// GetString 获取 key 对应的 string 值, 不存在或者类型不匹配时返回零值
+func (c *Context) GetString(key string) (s string) {
+	s, _ = Value[string](c, key)
+	return
+}
+
+// GetInt 获取 key 对应的 int 值
+func (c *Context) GetInt(key string) (i int) {
+	i, _ = Value[int](c, key)
+	return
+}
+
+// GetInt64 获取 key 对应的 int64 值
+func (c *Context) GetInt64(key string) (i int64) {
+	i, _ = Value[int64](c, key)
+	return
+}
+
+// GetBool 获取 key 对应的 bool 值
+func (c *Context) GetBool(key string) (b bool) {
+	b, _ = Value[bool](c, key)
+	return
+}
+
+// GetTime 获取 key 对应的 time.Time 值
+func (c *Context) GetTime(key string) (t time.Time) {
+	t, _ = Value[time.Time](c, key)
+	return
+}
+
+// GetDuration 获取 key 对应的 time.Duration 值
+func (c *Context) GetDuration(key string) (d time.Duration) {
+	d, _ = Value[time.Duration](c, key)
+	return
+}
+
+// GetStringSlice 获取 key 对应的 []string 值
+func (c *Context) GetStringSlice(key string) (ss []string) {
+	ss, _ = Value[[]string](c, key)
+	return
+}
+
+// GetStringMap 获取 key 对应的 map[string]any 值
+func (c *Context) GetStringMap(key string) (sm map[string]any) {
+	sm, _ = Value[map[string]any](c, key)
+	return
+}
+
+// Value 以类型 T 获取 key 对应的值, 不存在或者类型不匹配时 ok 为 false, 不会 panic
+func Value[T any](c *Context, key string) (val T, ok bool) {
+	v, exist := c.Get(key)
+	if !exist {
+		return
+	}
+	val, ok = v.(T)
+	return
+}
+
+// Key 带有类型信息的键, 中间件之间可以通过同一个 Key 共享强类型的值, 比如:
+//
+//	var UserKey = gee.Key[*User]("user")
+//	UserKey.Set(c, user)
+//	user, ok := UserKey.Get(c)
+type Key[T any] string
+
+// Set 以该键存储类型为 T 的值
+func (k Key[T]) Set(c *Context, val T) {
+	c.Set(string(k), val)
+}
+
+// Get 以该键获取类型为 T 的值
+func (k Key[T]) Get(c *Context) (T, bool) {
+	return Value[T](c, string(k))
+}
+
+// MustGet 以该键获取类型为 T 的值, 不存在或者类型不匹配时 panic
+func (k Key[T]) MustGet(c *Context) T {
+	val, ok := k.Get(c)
+	if !ok {
+		panic("[GEE] | Key \"" + string(k) + "\" does not exist or has wrong type")
+	}
+	return val
+}
+
 // ShouldBind 处理Form和Json数据
 func (c *Context) ShouldBind(obj any) error {
 	if obj == nil {
 		return binding.ErrNullData
 	}
-	b := binding.Default(c.Method, c.GetHeader("Content-Type"))
+	contentType := c.GetHeader("Content-Type")
+	// 提前按照 Engine 的内存限制解析 multipart 表单, 之后 binding 中的解析不会再重复执行
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		if _, err := c.MultipartForm(); err != nil {
+			return err
+		}
+	}
+	b := binding.Default(c.Method, contentType)
 	return b.Bind(c.Req, obj)
 }
+
+// Deadline 返回请求上下文的截止时间, 没有请求时 ok 为 false
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	if c.Req == nil {
+		return
+	}
+	return c.Req.Context().Deadline()
+}
+
+// Done 返回请求上下文的取消通道, 客户端断开或者服务关闭时会被关闭
+func (c *Context) Done() <-chan struct{} {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Done()
+}
+
+// Err 返回请求上下文被取消的原因
+func (c *Context) Err() error {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Err()
+}
+
+// Value 优先从 Keys 中查找字符串类型的键, 找不到时再回退到请求上下文中查找。
+// 这样通过 Set 存储的值对下游的库同样可见
+func (c *Context) Value(key any) any {
+	if keyAsString, ok := key.(string); ok {
+		if val, exist := c.Get(keyAsString); exist {
+			return val
+		}
+	}
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Value(key)
+}
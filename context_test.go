@@ -0,0 +1,319 @@
+package gee
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+func TestContextImplementsContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "req"), time.Second)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	c := newContext(httptest.NewRecorder(), req)
+	c.Set("user", "gee")
+
+	if v := c.Value("user"); v != "gee" {
+		t.Fatalf("Value(user) = %v, want gee", v)
+	}
+	if v := c.Value(ctxKey{}); v != "req" {
+		t.Fatalf("Value(ctxKey) = %v, want req", v)
+	}
+	if _, ok := c.Deadline(); !ok {
+		t.Fatal("deadline should be inherited from request context")
+	}
+
+	cancel()
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done should be closed after request context is canceled")
+	}
+	if c.Err() != context.Canceled {
+		t.Fatalf("Err() = %v, want %v", c.Err(), context.Canceled)
+	}
+}
+
+func TestContextWithoutRequest(t *testing.T) {
+	c := &Context{}
+	if _, ok := c.Deadline(); ok {
+		t.Fatal("deadline should not be set without request")
+	}
+	if c.Done() != nil || c.Err() != nil || c.Value("k") != nil {
+		t.Fatal("empty context should return zero values")
+	}
+}
+
+func TestContextCopy(t *testing.T) {
+	r := New()
+	done := make(chan *Context, 1)
+	r.GET("/user/:id", func(c *Context) {
+		c.Set("user", "gee")
+		cp := c.Copy()
+		go func() {
+			// 等待处理函数返回并且原上下文被修改之后再读取快照
+			time.Sleep(10 * time.Millisecond)
+			done <- cp
+		}()
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/user/42", nil)
+	r.ServeHTTP(w, req)
+	// 模拟上下文在请求结束后被复用
+	req.URL.Path = "/reused"
+
+	cp := <-done
+	if cp.Param("id") != "42" || cp.Path != "/user/42" || cp.Req.URL.Path != "/user/42" {
+		t.Fatalf("copy should keep request data, got id=%q path=%q", cp.Param("id"), cp.Path)
+	}
+	if v, _ := cp.Get("user"); v != "gee" {
+		t.Fatalf("copy should keep keys, got %v", v)
+	}
+	if cp.Writer != nil || cp.handlers != nil {
+		t.Fatal("copy should not hold writer or handlers")
+	}
+}
+
+func TestContextCopyIsolated(t *testing.T) {
+	c := newContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	c.Params["id"] = "1"
+	c.Set("k", 1)
+	cp := c.Copy()
+
+	c.Params["id"] = "2"
+	c.Set("k", 2)
+	if cp.Param("id") != "1" {
+		t.Fatal("params of copy should not change with original")
+	}
+	if v, _ := cp.Get("k"); v != 1 {
+		t.Fatal("keys of copy should not change with original")
+	}
+}
+
+func newUploadRequest(t *testing.T, field, filename, content string) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte(content))
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestContextSaveUploadedFile(t *testing.T) {
+	dir := t.TempDir()
+	r := New()
+	r.POST("/upload", func(c *Context) {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.AbortWithJson(http.StatusBadRequest, err.Error())
+			return
+		}
+		if err = c.SaveUploadedFile(fh, dir+"/../escape.txt"); err != ErrUnsafePath {
+			t.Errorf("traversal should be rejected, got %v", err)
+		}
+		if err = c.SaveUploadedFile(fh, dir); err != nil {
+			c.AbortWithJson(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newUploadRequest(t, "file", "hello.txt", "hello gee"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "hello.txt"))
+	if err != nil || string(data) != "hello gee" {
+		t.Fatalf("saved file = %q, err = %v", data, err)
+	}
+}
+
+func TestContextMultipartTempFilesRemoved(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	r := Default(WithMaxMultipartMemory(1), WithReleaseMode(true), WithMiddlewares(RequestID()))
+	r.POST("/upload", func(c *Context) {
+		if _, err := c.FormFile("file"); err != nil {
+			c.AbortWithJson(http.StatusBadRequest, err.Error())
+			return
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) == 0 {
+			t.Error("upload should spill to a temp file")
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newUploadRequest(t, "file", "big.bin", strings.Repeat("x", 4<<10)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("temp files should be removed after the request, got %d", len(entries))
+	}
+}
+
+func TestMaxUploadSize(t *testing.T) {
+	r := Default(WithMaxMultipartMemory(1), WithReleaseMode(true), WithMiddlewares(Recover()))
+	r.POST("/upload", MaxUploadSize(16), func(c *Context) {
+		_, _ = c.FormFile("file")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newUploadRequest(t, "file", "big.txt", strings.Repeat("x", 64)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", w.Code)
+	}
+
+	// 没有 Content-Length 时, 在读取超出限制后补充 413
+	w = httptest.NewRecorder()
+	req := newUploadRequest(t, "file", "big.txt", strings.Repeat("x", 64))
+	req.ContentLength = -1
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", w.Code)
+	}
+}
+
+func TestContextRedirect(t *testing.T) {
+	r := New()
+	r.GET("/old", func(c *Context) {
+		c.Redirect(http.StatusMovedPermanently, "/new")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/old", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/new" {
+		t.Fatalf("status = %d, location = %q", w.Code, w.Header().Get("Location"))
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("redirect with status 200 should panic")
+		}
+	}()
+	c := newContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	c.Redirect(http.StatusOK, "/new")
+}
+
+func TestContextForward(t *testing.T) {
+	r := New()
+	r.GET("/legacy/:id", func(c *Context) {
+		c.Forward("/users/" + c.Param("id"))
+	}, func(c *Context) {
+		t.Error("handlers after Forward should not run")
+	})
+	r.GET("/users/:id", func(c *Context) {
+		c.String(http.StatusOK, "user %s", c.Param("id"))
+	})
+	r.GET("/loop", func(c *Context) {
+		c.Forward("/loop")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/legacy/7", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "user 7" {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/loop", nil))
+	if w.Code != http.StatusLoopDetected {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusLoopDetected)
+	}
+}
+
+func TestContextForwardMiddlewares(t *testing.T) {
+	runs := map[string]int{}
+	count := func(name string) HandlerFunc {
+		return func(c *Context) {
+			runs[name]++
+			c.Next()
+		}
+	}
+	r := New()
+	r.Use(count("root"))
+	r.GET("/legacy", func(c *Context) {
+		c.Forward("/admin/users")
+	})
+	admin := r.Group("/admin")
+	admin.Use(count("admin"))
+	admin.GET("/old", func(c *Context) {
+		c.Forward("/admin/users")
+	})
+	admin.GET("/users", func(c *Context) {
+		c.String(http.StatusOK, "users")
+	})
+
+	tests := []struct {
+		path  string
+		root  int
+		admin int
+	}{
+		{"/legacy", 1, 1},
+		{"/admin/old", 1, 1},
+	}
+	for _, tt := range tests {
+		runs = map[string]int{}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Body.String() != "users" || runs["root"] != tt.root || runs["admin"] != tt.admin {
+			t.Errorf("%s: body = %q, runs = %v", tt.path, w.Body.String(), runs)
+		}
+	}
+}
+
+func TestContextTypedGetters(t *testing.T) {
+	c := newContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	now := time.Now()
+	c.Set("name", "gee")
+	c.Set("age", 3)
+	c.Set("ok", true)
+	c.Set("now", now)
+	c.Set("tags", []string{"a", "b"})
+
+	if c.GetString("name") != "gee" || c.GetInt("age") != 3 || !c.GetBool("ok") {
+		t.Fatal("typed getters should return stored values")
+	}
+	if !c.GetTime("now").Equal(now) || len(c.GetStringSlice("tags")) != 2 {
+		t.Fatal("typed getters should return stored values")
+	}
+	// 类型不匹配时返回零值
+	if c.GetInt("name") != 0 || c.GetString("missing") != "" {
+		t.Fatal("mismatched or missing key should return zero value")
+	}
+	if v, ok := Value[int](c, "name"); ok || v != 0 {
+		t.Fatal("Value should report mismatched type")
+	}
+
+	type user struct{ Name string }
+	userKey := Key[*user]("user")
+	userKey.Set(c, &user{Name: "gee"})
+	if u, ok := userKey.Get(c); !ok || u.Name != "gee" {
+		t.Fatal("typed key should return stored value")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("MustGet should panic on missing key")
+		}
+	}()
+	c.MustGet("missing")
+}
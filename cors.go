@@ -0,0 +1,162 @@
+package gee
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CorsConfig 跨域中间件的配置
+type CorsConfig struct {
+	// AllowOrigins 允许的来源, 支持完整匹配 https://a.com, 子域名通配 https://*.a.com 以及 * 允许所有来源
+	AllowOrigins []string
+	// AllowOriginFunc 自定义来源校验, 与 AllowOrigins 任意一个通过即可
+	AllowOriginFunc func(origin string) bool
+	// AllowMethods 允许的请求方法
+	AllowMethods []string
+	// AllowHeaders 允许的请求头, * 表示允许所有请求头
+	AllowHeaders []string
+	// ExposeHeaders XMLHttpRequest 的响应对象能拿到的额外字段
+	ExposeHeaders []string
+	// AllowCredentials 是否允许携带 Cookie 等认证信息, 只对 AllowOrigins 中明确列出或者 AllowOriginFunc 通过的来源生效,
+	// 通过 * 匹配的来源永远不会得到该响应头
+	AllowCredentials bool
+	// MaxAge 预请求的缓存时间
+	MaxAge time.Duration
+}
+
+// DefaultCorsConfig 允许所有来源但不允许携带认证信息的配置
+func DefaultCorsConfig() CorsConfig {
+	return CorsConfig{
+		AllowOrigins:  []string{"*"},
+		AllowMethods:  []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		AllowHeaders:  []string{"Content-Type", "Content-Length", "Token", "Authorization"},
+		ExposeHeaders: []string{"Token"},
+		MaxAge:        24 * time.Hour,
+	}
+}
+
+// Cors 跨域中间件, 使用 DefaultCorsConfig
+func Cors() HandlerFunc {
+	return CorsWithConfig(DefaultCorsConfig())
+}
+
+// CorsWithConfig 根据配置创建跨域中间件。
+// 预请求的来源, 方法或者请求头不被允许时返回 403; 普通请求的来源不被允许时不设置跨域响应头, 由浏览器拦截
+func CorsWithConfig(conf CorsConfig) HandlerFunc {
+	var (
+		allowAll  bool
+		exact     = make(map[string]struct{})
+		wildcards [][2]string // 通配符两边的前缀和后缀
+	)
+	for _, o := range conf.AllowOrigins {
+		o = strings.ToLower(o)
+		switch {
+		case o == "*":
+			allowAll = true
+		case strings.Contains(o, "*"):
+			i := strings.Index(o, "*")
+			wildcards = append(wildcards, [2]string{o[:i], o[i+1:]})
+		default:
+			exact[o] = struct{}{}
+		}
+	}
+
+	allowMethods := make(map[string]struct{}, len(conf.AllowMethods))
+	for _, m := range conf.AllowMethods {
+		allowMethods[strings.ToUpper(m)] = struct{}{}
+	}
+	allowAllHeaders := false
+	allowHeaders := make(map[string]struct{}, len(conf.AllowHeaders))
+	for _, h := range conf.AllowHeaders {
+		if h == "*" {
+			allowAllHeaders = true
+		}
+		allowHeaders[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+	methods := strings.Join(conf.AllowMethods, ", ")
+	headers := strings.Join(conf.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(conf.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(int(conf.MaxAge / time.Second))
+
+	// trusted 表示来源被明确允许, 只有这种情况才允许携带认证信息
+	checkOrigin := func(origin string) (allowed, trusted bool) {
+		lower := strings.ToLower(origin)
+		if _, ok := exact[lower]; ok {
+			return true, true
+		}
+		for _, w := range wildcards {
+			if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+				return true, true
+			}
+		}
+		if conf.AllowOriginFunc != nil && conf.AllowOriginFunc(origin) {
+			return true, true
+		}
+		return allowAll, false
+	}
+
+	return func(c *Context) {
+		origin := c.GetHeader("Origin")
+		// 如果origin为 "" 说明不是跨域，null 不等于 ""
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		preflight := c.Req.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		allowed, trusted := checkOrigin(origin)
+		if !allowed {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if !trusted {
+			// 通过 * 匹配的来源
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if conf.AllowCredentials && trusted {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		// 说明这个请求是一个预请求，校验之后提前返回
+		if preflight {
+			if _, ok := allowMethods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))]; !ok {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			for _, h := range headerTokens(c.Req.Header, "Access-Control-Request-Headers") {
+				if _, ok := allowHeaders[http.CanonicalHeaderKey(h)]; !ok && !allowAllHeaders {
+					c.AbortWithStatus(http.StatusForbidden)
+					return
+				}
+			}
+			c.Header("Access-Control-Allow-Methods", methods)
+			if allowAllHeaders {
+				c.Header("Access-Control-Allow-Headers", c.GetHeader("Access-Control-Request-Headers"))
+			} else {
+				c.Header("Access-Control-Allow-Headers", headers)
+			}
+			if conf.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Header("Access-Control-Expose-Headers", exposeHeaders)
+		c.Next()
+	}
+}
@@ -0,0 +1,98 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newCorsEngine(conf CorsConfig) *Engine {
+	r := Default(WithReleaseMode(true), WithMiddlewares(CorsWithConfig(conf)))
+	r.GET("/data", func(c *Context) {
+		c.String(http.StatusOK, "data")
+	})
+	return r
+}
+
+func corsRequest(r *Engine, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/data", nil)
+	req.Header.Set("Origin", origin)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCorsWithConfigOrigins(t *testing.T) {
+	r := newCorsEngine(CorsConfig{
+		AllowOrigins:     []string{"https://app.example.com", "https://*.trusted.com"},
+		AllowOriginFunc:  func(origin string) bool { return origin == "https://partner.io" },
+		AllowMethods:     []string{http.MethodGet},
+		AllowCredentials: true,
+	})
+
+	for _, origin := range []string{"https://app.example.com", "https://api.trusted.com", "https://partner.io"} {
+		w := corsRequest(r, http.MethodGet, origin, nil)
+		if w.Header().Get("Access-Control-Allow-Origin") != origin ||
+			w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("%s should be allowed with credentials, header = %v", origin, w.Header())
+		}
+		if w.Header().Get("Vary") != "Origin" {
+			t.Errorf("Vary should be Origin, got %q", w.Header().Get("Vary"))
+		}
+	}
+
+	for _, origin := range []string{"https://evil.com", "https://trusted.com", "https://app.example.com.evil.com"} {
+		w := corsRequest(r, http.MethodGet, origin, nil)
+		if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+			t.Errorf("%s should not get cors headers, header = %v", origin, w.Header())
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("simple request from %s should still be handled, status = %d", origin, w.Code)
+		}
+	}
+}
+
+func TestCorsDefaultNoCredentials(t *testing.T) {
+	conf := DefaultCorsConfig()
+	conf.AllowCredentials = true
+	w := corsRequest(newCorsEngine(conf), http.MethodGet, "https://any.com", nil)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("wildcard origin should not allow credentials, header = %v", w.Header())
+	}
+}
+
+func TestCorsPreflight(t *testing.T) {
+	r := newCorsEngine(CorsConfig{
+		AllowOrigins: []string{"https://app.example.com"},
+		AllowMethods: []string{http.MethodGet, http.MethodPost},
+		AllowHeaders: []string{"Content-Type", "X-Token"},
+		MaxAge:       time.Hour,
+	})
+
+	w := corsRequest(r, http.MethodOptions, "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method":  http.MethodPost,
+		"Access-Control-Request-Headers": "content-type, x-token",
+	})
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Max-Age") != "3600" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "GET, POST" {
+		t.Fatalf("preflight should pass, status = %d, header = %v", w.Code, w.Header())
+	}
+
+	tests := []map[string]string{
+		{"Access-Control-Request-Method": http.MethodDelete},
+		{"Access-Control-Request-Method": http.MethodPost, "Access-Control-Request-Headers": "X-Other"},
+	}
+	for _, headers := range tests {
+		if w = corsRequest(r, http.MethodOptions, "https://app.example.com", headers); w.Code != http.StatusForbidden {
+			t.Errorf("preflight %v should be rejected, status = %d", headers, w.Code)
+		}
+	}
+	w = corsRequest(r, http.MethodOptions, "https://evil.com", map[string]string{"Access-Control-Request-Method": http.MethodGet})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("preflight from disallowed origin should be rejected, status = %d", w.Code)
+	}
+}
@@ -0,0 +1,183 @@
+package gee
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// snippetLines 调试页面中每一帧前后展示的源码行数
+const snippetLines = 3
+
+// debugPageTemplate 非发行版本下发生 panic 时返回的调试页面
+var debugPageTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>[GEE] panic: {{.Panic}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; color: #222; }
+header { background: #c0392b; color: #fff; padding: 16px 24px; }
+header h1 { margin: 0; font-size: 20px; word-break: break-all; }
+header p { margin: 6px 0 0; opacity: .85; }
+section { padding: 8px 24px; }
+h2 { font-size: 16px; border-bottom: 1px solid #ddd; padding-bottom: 4px; }
+table { border-collapse: collapse; font-size: 13px; }
+td { padding: 2px 12px 2px 0; vertical-align: top; font-family: Menlo, Consolas, monospace; word-break: break-all; }
+.frame { margin-bottom: 12px; }
+.frame .fn { font-weight: bold; font-family: Menlo, Consolas, monospace; font-size: 13px; }
+.frame .file { color: #666; font-family: Menlo, Consolas, monospace; font-size: 12px; }
+pre { background: #f6f8fa; margin: 4px 0; padding: 6px 0; font-size: 12px; overflow-x: auto; }
+pre span { display: block; padding: 0 8px; }
+pre span.current { background: #fde2e1; }
+</style>
+</head>
+<body>
+<header>
+<h1>panic: {{.Panic}}</h1>
+<p>{{.Method}} {{.URL}}{{if .Route}} &mdash; route {{.Route}}{{end}}</p>
+</header>
+<section>
+<h2>Stack</h2>
+{{range .Frames}}<div class="frame">
+<div class="fn">{{.Function}}</div>
+<div class="file">{{.File}}:{{.Line}}</div>
+{{if .Snippet}}<pre>{{range .Snippet}}<span{{if .Current}} class="current"{{end}}>{{printf "%5d" .Number}}  {{.Code}}</span>{{end}}</pre>{{end}}
+</div>
+{{end}}
+</section>
+{{if .Params}}<section>
+<h2>Params</h2>
+<table>{{range .Params}}<tr><td>{{.Key}}</td><td>{{.Value}}</td></tr>{{end}}</table>
+</section>{{end}}
+{{if .Query}}<section>
+<h2>Query</h2>
+<table>{{range .Query}}<tr><td>{{.Key}}</td><td>{{.Value}}</td></tr>{{end}}</table>
+</section>{{end}}
+<section>
+<h2>Headers</h2>
+<table>{{range .Headers}}<tr><td>{{.Key}}</td><td>{{.Value}}</td></tr>{{end}}</table>
+</section>
+</body>
+</html>
+`))
+
+type debugPage struct {
+	Panic   string
+	Method  string
+	URL     string
+	Route   string
+	Frames  []debugFrame
+	Params  []debugPair
+	Query   []debugPair
+	Headers []debugPair
+}
+
+type debugFrame struct {
+	stackFrame
+	Snippet []debugLine
+}
+
+type debugLine struct {
+	Number  int
+	Code    string
+	Current bool
+}
+
+type debugPair struct {
+	Key   string
+	Value string
+}
+
+// renderDebugPage 返回包含 panic 信息, 调用栈源码以及请求信息的 HTML 页面
+func renderDebugPage(c *Context, err any, frames []stackFrame, sensitive []string) {
+	page := debugPage{
+		Panic:  fmt.Sprint(err),
+		Method: c.Req.Method,
+		URL:    c.Req.URL.RequestURI(),
+		Route:  c.FullPath(),
+		Frames: make([]debugFrame, 0, len(frames)),
+	}
+
+	sources := make(map[string][]string)
+	for _, f := range frames {
+		page.Frames = append(page.Frames, debugFrame{stackFrame: f, Snippet: sourceSnippet(sources, f.File, f.Line)})
+	}
+	for k, v := range c.Params {
+		page.Params = append(page.Params, debugPair{Key: k, Value: v})
+	}
+	page.Query = sortedPairs(c.Req.URL.Query(), nil)
+	page.Headers = sortedPairs(url.Values(c.Req.Header), sensitive)
+	sort.Slice(page.Params, func(i, j int) bool { return page.Params[i].Key < page.Params[j].Key })
+
+	c.Header("Content-Type", "text/html;charset=utf-8")
+	c.Status(http.StatusInternalServerError)
+	_ = debugPageTemplate.Execute(c.Writer, page)
+}
+
+// sourceSnippet 读取 file 中 line 前后 snippetLines 行源码, 同一个文件只读取一次
+func sourceSnippet(sources map[string][]string, file string, line int) []debugLine {
+	lines, ok := sources[file]
+	if !ok {
+		if data, err := os.ReadFile(file); err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		sources[file] = lines
+	}
+	if line <= 0 || line > len(lines) {
+		return nil
+	}
+
+	start, end := line-snippetLines, line+snippetLines
+	if start < 1 {
+		start = 1
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+	snippet := make([]debugLine, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		snippet = append(snippet, debugLine{Number: i, Code: lines[i-1], Current: i == line})
+	}
+	return snippet
+}
+
+// sortedPairs 将多值的键值对展开并按键排序, sensitive 中的键会被隐藏
+func sortedPairs(values url.Values, sensitive []string) []debugPair {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]debugPair, 0, len(keys))
+	for _, k := range keys {
+		redact := false
+		for _, h := range sensitive {
+			if strings.EqualFold(h, k) {
+				redact = true
+				break
+			}
+		}
+		for _, v := range values[k] {
+			if redact {
+				v = "[REDACTED]"
+			}
+			pairs = append(pairs, debugPair{Key: k, Value: v})
+		}
+	}
+	return pairs
+}
+
+// acceptsHTML 客户端是否接受 HTML 响应, 只接受 JSON 的客户端仍然返回 JSON
+func acceptsHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" || strings.Contains(accept, "text/html") {
+		return true
+	}
+	return !strings.Contains(accept, "application/json")
+}
@@ -0,0 +1,86 @@
+package gee
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultDecompressMaxSize 解压之后请求体的默认大小限制
+const defaultDecompressMaxSize = 32 << 20
+
+// Decompress 解压 Content-Encoding 为 gzip 或者 deflate 的请求体, 之后的 ShouldBind 等读取到的都是解压后的数据。
+// 解压后的数据超过 maxSize 时读取会返回 *http.MaxBytesError, 如果处理函数没有写回响应则返回 413, 用于防止压缩炸弹;
+// maxSize <= 0 时使用 32MB。不支持的编码返回 415, 数据格式错误返回 400
+func Decompress(maxSize int64) HandlerFunc {
+	if maxSize <= 0 {
+		maxSize = defaultDecompressMaxSize
+	}
+	return func(c *Context) {
+		encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+		if encoding == "" || encoding == "identity" || c.Req.Body == nil || c.Req.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		decoded, err := newDecompressor(encoding, c.Req.Body)
+		if err == errUnsupportedEncoding {
+			c.AbortWithJson(http.StatusUnsupportedMediaType, "unsupported content encoding: "+encoding)
+			return
+		}
+		if err != nil {
+			c.AbortWithJson(http.StatusBadRequest, "invalid "+encoding+" body: "+err.Error())
+			return
+		}
+
+		body := &maxBytesBody{ReadCloser: http.MaxBytesReader(c.Writer, &decompressBody{ReadCloser: decoded, body: c.Req.Body}, maxSize)}
+		c.Req.Body = body
+		c.Req.ContentLength = -1
+		c.Req.Header.Del("Content-Encoding")
+		c.Req.Header.Del("Content-Length")
+		c.Next()
+
+		if body.exceeded && c.StatusCode == 0 {
+			c.AbortWithJson(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+		}
+	}
+}
+
+var errUnsupportedEncoding = errors.New("[GEE] unsupported content encoding")
+
+// newDecompressor 根据编码创建解压器, deflate 同时兼容 zlib 格式和不带 zlib 头部的原始格式
+func newDecompressor(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case GzipEncoding, "x-gzip":
+		return gzip.NewReader(r)
+	case DeflateEncoding:
+		br := bufio.NewReader(r)
+		if head, err := br.Peek(2); err == nil && isZlibHeader(head) {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
+
+// isZlibHeader 判断是否为 RFC 1950 的 zlib 头部
+func isZlibHeader(h []byte) bool {
+	return h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0
+}
+
+// decompressBody 关闭时同时关闭解压器和原始的请求体
+type decompressBody struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (b *decompressBody) Close() error {
+	_ = b.ReadCloser.Close()
+	return b.body.Close()
+}
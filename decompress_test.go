@@ -0,0 +1,82 @@
+package gee
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func compressBody(t *testing.T, encoding string, data []byte) *bytes.Buffer {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	default:
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestDecompress(t *testing.T) {
+	type telemetry struct {
+		Agent string `json:"agent" binding:"required"`
+		Count int    `json:"count"`
+	}
+	r := Default(WithReleaseMode(true), WithMiddlewares(Decompress(1024)))
+	r.POST("/telemetry", func(c *Context) {
+		var req telemetry
+		if err := c.ShouldBind(&req); err != nil {
+			return
+		}
+		c.String(http.StatusOK, "%s:%d", req.Agent, req.Count)
+	})
+
+	do := func(encoding string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/telemetry", body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	payload := []byte(`{"agent":"a1","count":3}`)
+	for _, tt := range []struct{ format, encoding string }{
+		{"gzip", "gzip"},
+		{"zlib", "deflate"},
+		{"flate", "deflate"},
+	} {
+		if w := do(tt.encoding, compressBody(t, tt.format, payload)); w.Code != http.StatusOK || w.Body.String() != "a1:3" {
+			t.Errorf("%s body should be decoded, status = %d, body = %q", tt.format, w.Code, w.Body.String())
+		}
+	}
+	if w := do("", bytes.NewReader(payload)); w.Body.String() != "a1:3" {
+		t.Errorf("plain body should be bound as is, body = %q", w.Body.String())
+	}
+
+	bomb := []byte(`{"agent":"` + strings.Repeat("a", 1<<20) + `"}`)
+	if w := do("gzip", compressBody(t, "gzip", bomb)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("decompressed body over the limit should be rejected, status = %d", w.Code)
+	}
+	if w := do("br", bytes.NewReader(payload)); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("unsupported encoding should be rejected, status = %d", w.Code)
+	}
+	if w := do("gzip", bytes.NewReader(payload)); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid gzip body should be rejected, status = %d", w.Code)
+	}
+}
@@ -4,14 +4,28 @@ import (
 	"context"
 	"fmt"
 	"html/template"
+	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
+const (
+	defaultMultipartMemory = 32 << 20 // 32 MiB
+	defaultShutdownTimeout = 5 * time.Second
+
+	// Default 使用的服务超时配置, 防止慢速攻击长时间占用连接
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 60 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultMaxHeaderBytes    = 1 << 20 // 1 MiB
+)
+
 type HandlerFunc func(*Context)
 
 type Engine struct {
@@ -21,52 +35,327 @@ type Engine struct {
 
 	releaseMode bool // 是否为发行版本
 	exitOp      bool // 是否开启优雅关机
+	logger      Log  // 框架内部的日志输出
+
+	maxMultipartMemory int64  // 解析 multipart 表单时允许使用的最大内存, 超出的部分会写入临时文件
+	httpsRedirectAddr  string // RunTLS 时额外开启的 HTTP 重定向服务地址
+
+	serverConf serverConfig // http.Server 的配置
+	h2c        bool         // 是否开启 h2c
+	http2Conf  *HTTP2Config // HTTP/2 配置
+
+	shutdownTimeout time.Duration                     // 优雅关机的超时时间
+	shutdownSignals []os.Signal                       // 触发优雅关机的信号
+	shutdownHooks   []func(ctx context.Context) error // 服务关闭之后按顺序执行的函数
+	srvMu           sync.Mutex                        // 保护 servers, listeners 和 shutdown
+	servers         []*http.Server                    // 正在运行的服务
+	listeners       []net.Listener                    // 正在运行的服务对应的 listener, 平滑重启时交给新进程
+	shutdown        bool                              // 是否已经调用了 Shutdown, 之后启动的服务直接关闭
+
+	gracefulRestart bool // 是否开启平滑重启
 
 	htmlTemplates *template.Template // 静态模板
 	funcMap       template.FuncMap
 }
 
+// serverConfig 创建 http.Server 时使用的配置, 零值与 http.Server 的默认行为一致
+type serverConfig struct {
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	errorLog          *log.Logger
+	disableKeepAlives bool
+	connState         func(net.Conn, http.ConnState)
+}
+
 // ServeHTTP 实现Handler接口，底层进行HTTP服务解析。
 func (engine *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	c := newContext(w, r)
 	c.engine = engine
+	engine.handleContext(c)
+	// http.Server 只清理原始请求的 multipart 临时文件, 中间件使用 WithContext 替换请求之后需要在这里清理
+	if c.Req != r && c.Req.MultipartForm != nil {
+		_ = c.Req.MultipartForm.RemoveAll()
+	}
+}
+
+// handleContext 根据 c.Path 组装分组中间件并交给路由处理。
+// 内部转发时, 已经匹配过转发前路径的分组中间件不会再次执行, 避免日志, 限流和认证等中间件重复执行
+func (engine *Engine) handleContext(c *Context) {
 	for _, group := range engine.groups {
-		if strings.HasPrefix(r.URL.Path, group.prefix) {
+		if strings.HasPrefix(c.Path, group.prefix) && !matchedBefore(c.visited, group.prefix) {
 			c.handlers = append(c.handlers, group.middlewares...)
 		}
 	}
 	engine.router.handle(c)
 }
 
+// matchedBefore 转发前的路径中是否有匹配 prefix 的
+func matchedBefore(visited []string, prefix string) bool {
+	for _, path := range visited {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // Run 在addr开启监听
 func (engine *Engine) Run(addr string) (err error) {
+	if addr == "" {
+		addr = ":http"
+	}
+	listener, err := engine.listen("tcp", addr)
+	if err != nil {
+		return
+	}
+	srv := engine.newServer(addr)
+	return engine.serve(serverRunner{srv: srv, listener: listener, serve: func() error {
+		return srv.Serve(listener)
+	}})
+}
+
+// RunTLS 在addr开启 HTTPS 监听, 如果设置了 WithHTTPSRedirect, 会同时开启一个将 HTTP 请求重定向到 HTTPS 的服务
+func (engine *Engine) RunTLS(addr, certFile, keyFile string) (err error) {
+	if addr == "" {
+		addr = ":https"
+	}
+	listener, err := engine.listen("tcp", addr)
+	if err != nil {
+		return
+	}
+	srv := engine.newServer(addr)
+	runners := []serverRunner{{srv: srv, listener: listener, serve: func() error {
+		return srv.ServeTLS(listener, certFile, keyFile)
+	}}}
+	if engine.httpsRedirectAddr != "" {
+		redirectListener, err := engine.listen("tcp", engine.httpsRedirectAddr)
+		if err != nil {
+			_ = listener.Close()
+			return err
+		}
+		redirect := engine.newServer(engine.httpsRedirectAddr)
+		redirect.Handler = httpsRedirectHandler(addr)
+		runners = append(runners, serverRunner{srv: redirect, listener: redirectListener, serve: func() error {
+			return redirect.Serve(redirectListener)
+		}})
+	}
+	return engine.serve(runners...)
+}
+
+// RunUnix 在 unix socket 文件上开启监听, 已经存在的同名文件会被删除, 服务结束后 listener 会删除该文件
+func (engine *Engine) RunUnix(file string) (err error) {
+	listener, err := engine.listen("unix", file)
+	if err != nil {
+		return
+	}
+	return engine.RunListener(listener)
+}
+
+// RunFd 在已经打开的文件描述符上开启监听, 通常由 systemd 等进程管理工具传入
+func (engine *Engine) RunFd(fd int) (err error) {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd@%d", fd))
+	listener, err := net.FileListener(f)
+	_ = f.Close()
+	if err != nil {
+		return
+	}
+	return engine.RunListener(listener)
+}
+
+// RunListener 在指定的 listener 上开启服务
+func (engine *Engine) RunListener(listener net.Listener) (err error) {
+	srv := engine.newServer(listener.Addr().String())
+	return engine.serve(serverRunner{srv: srv, listener: listener, serve: func() error {
+		return srv.Serve(listener)
+	}})
+}
+
+// Endpoint RunMulti 中的一个监听地址和处理该地址请求的 Engine, Engine 为 nil 时使用调用者本身
+type Endpoint struct {
+	Addr   string
+	Engine *Engine
+}
+
+// RunMulti 同时在多个地址上开启监听, 比如将对外的 API 和内部的监控路由分别放在不同端口。
+// 所有服务共享调用者的优雅关机配置, 调用者的 Shutdown 会关闭所有服务,
+// 任意一个服务出错时关闭其他服务并返回该错误
+func (engine *Engine) RunMulti(endpoints ...Endpoint) (err error) {
+	runners := make([]serverRunner, 0, len(endpoints))
+	for _, ep := range endpoints {
+		handler := ep.Engine
+		if handler == nil {
+			handler = engine
+		}
+		listener, listenErr := engine.listen("tcp", ep.Addr)
+		if listenErr != nil {
+			for _, runner := range runners {
+				_ = runner.listener.Close()
+			}
+			return listenErr
+		}
+		srv := handler.newServer(ep.Addr)
+		runners = append(runners, serverRunner{srv: srv, listener: listener, serve: func() error {
+			return srv.Serve(listener)
+		}})
+	}
+	return engine.serve(runners...)
+}
+
+// serverRunner 绑定一个 http.Server, 它的 listener 和启动方式
+type serverRunner struct {
+	srv      *http.Server
+	listener net.Listener
+	serve    func() error
+}
+
+// newServer 根据 Engine 的服务配置创建 http.Server
+func (engine *Engine) newServer(addr string) *http.Server {
+	conf := engine.serverConf
 	srv := &http.Server{
-		Addr:    addr,
-		Handler: engine,
+		Addr:              addr,
+		Handler:           engine,
+		ReadTimeout:       conf.readTimeout,
+		ReadHeaderTimeout: conf.readHeaderTimeout,
+		WriteTimeout:      conf.writeTimeout,
+		IdleTimeout:       conf.idleTimeout,
+		MaxHeaderBytes:    conf.maxHeaderBytes,
+		ErrorLog:          conf.errorLog,
+		ConnState:         conf.connState,
+	}
+	srv.SetKeepAlivesEnabled(!conf.disableKeepAlives)
+	engine.configureHTTP2(srv)
+	return srv
+}
+
+// serve 启动所有服务, 所有的运行方式共享同一套优雅关机流程。
+// 任意一个服务监听失败时关闭其他服务并返回该错误;
+// 开启优雅关机时收到关机信号, 或者调用 Engine.Shutdown 时正常返回
+func (engine *Engine) serve(runners ...serverRunner) (err error) {
+	engine.srvMu.Lock()
+	if engine.shutdown {
+		// Shutdown 发生在服务注册之前, 不再启动服务
+		engine.srvMu.Unlock()
+		for _, runner := range runners {
+			_ = runner.listener.Close()
+		}
+		return nil
+	}
+	for _, runner := range runners {
+		engine.servers = append(engine.servers, runner.srv)
+		engine.listeners = append(engine.listeners, runner.listener)
+	}
+	engine.srvMu.Unlock()
+
+	errCh := make(chan error, len(runners))
+	for _, runner := range runners {
+		go func(runner serverRunner) {
+			errCh <- runner.serve()
+		}(runner)
 	}
-	// 是否开启优雅关机
+
+	if engine.gracefulRestart {
+		// 由平滑重启启动时, 通知父进程可以开始关闭
+		notifyReady()
+	}
+
+	// 是否开启优雅关机和平滑重启, 未开启时对应的通道为 nil, 永远不会被选中
+	var exit, restart chan os.Signal
 	if engine.exitOp {
-		go func() {
-			if err = srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				if !engine.releaseMode {
-					_, _ = fmt.Fprintf(os.Stdout, "[GEE] listen is fail! err: %v\n", err)
-				}
+		exit = make(chan os.Signal, 1)
+		signal.Notify(exit, engine.shutdownSignals...)
+		defer signal.Stop(exit)
+	}
+	if engine.gracefulRestart && len(restartSignals) > 0 {
+		restart = make(chan os.Signal, 1)
+		signal.Notify(restart, restartSignals...)
+		defer signal.Stop(restart)
+	}
+
+	for {
+		select {
+		case err = <-errCh:
+			// 由 Engine.Shutdown 主动关闭
+			if err == http.ErrServerClosed {
+				return nil
+			}
+			engine.logger.Error("listen is fail", "err", err)
+			ctx, cancelFunc := context.WithTimeout(context.Background(), engine.shutdownTimeout)
+			_ = engine.Shutdown(ctx)
+			cancelFunc()
+			return
+		case <-exit:
+			ctx, cancelFunc := context.WithTimeout(context.Background(), engine.shutdownTimeout)
+			err = engine.Shutdown(ctx)
+			cancelFunc()
+			return
+		case <-restart:
+			// 新进程启动失败或者没有就绪时继续使用当前进程提供服务
+			if err = engine.restart(); err != nil {
+				engine.logger.Error("restart is fail", "err", err)
+				continue
 			}
-		}()
+			ctx, cancelFunc := context.WithTimeout(context.Background(), engine.shutdownTimeout)
+			err = engine.Shutdown(ctx)
+			cancelFunc()
+			return
+		}
+	}
+}
 
-		exit := make(chan os.Signal, 1)
-		signal.Notify(exit, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
-		<-exit
+// Shutdown 优雅地关闭所有正在运行的服务, 之后按照注册顺序执行 OnShutdown 注册的函数。
+// 返回遇到的第一个错误, 但是所有的关闭操作都会执行。
+// Shutdown 之后 Run 等方法不再启动服务而是直接返回, 因此在服务启动之前调用也能让它退出
+func (engine *Engine) Shutdown(ctx context.Context) (err error) {
+	engine.srvMu.Lock()
+	engine.shutdown = true
+	servers := engine.servers
+	engine.servers = nil
+	engine.listeners = nil
+	engine.srvMu.Unlock()
+	if len(servers) == 0 {
+		return
+	}
 
-		ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
-		err = srv.Shutdown(ctx)
-		cancelFunc()
-	} else {
-		err = srv.ListenAndServe()
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(ctx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	for _, hook := range engine.shutdownHooks {
+		if hookErr := hook(ctx); hookErr != nil && err == nil {
+			err = hookErr
+		}
 	}
 	return
 }
 
+// OnShutdown 注册服务关闭之后执行的函数, 比如关闭数据库连接池, 按照注册顺序执行
+func (engine *Engine) OnShutdown(hooks ...func(ctx context.Context) error) {
+	engine.shutdownHooks = append(engine.shutdownHooks, hooks...)
+}
+
+// httpsRedirectHandler 将 HTTP 请求重定向到 tlsAddr 对应端口的 HTTPS 地址
+func httpsRedirectHandler(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
+
 // SetFuncMap 将所有的模板加载进内存
 func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 	engine.funcMap = funcMap
@@ -79,7 +368,13 @@ func (engine *Engine) LoadHTMLGlob(pattern string) {
 
 // New 默认配置
 func New() *Engine {
-	engine := &Engine{router: newRouter()}
+	engine := &Engine{
+		router:             newRouter(),
+		logger:             defaultLog,
+		maxMultipartMemory: defaultMultipartMemory,
+		shutdownTimeout:    defaultShutdownTimeout,
+		shutdownSignals:    []os.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT},
+	}
 	engine.RouterGroup = &RouterGroup{engine: engine}
 	engine.groups = []*RouterGroup{engine.RouterGroup}
 	return engine
@@ -106,6 +401,33 @@ func WithExitOp(exitop bool) IEngine {
 	})
 }
 
+// WithShutdownTimeout 设置优雅关机的超时时间枢纽
+func WithShutdownTimeout(timeout time.Duration) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		if timeout > 0 {
+			engine.shutdownTimeout = timeout
+		}
+	})
+}
+
+// WithShutdownSignals 设置触发优雅关机的信号枢纽, 默认为 SIGTERM, SIGINT, SIGQUIT
+func WithShutdownSignals(signals ...os.Signal) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		if len(signals) > 0 {
+			engine.shutdownSignals = signals
+		}
+	})
+}
+
+// WithGracefulRestart 开启平滑重启枢纽, 仅支持 Linux。
+// 收到 SIGHUP 或者 SIGUSR2 时启动新的进程并将正在监听的 socket 交给它, 新进程开始提供服务之后,
+// 当前进程处理完剩余请求后退出; 新进程启动失败或者没有就绪时当前进程继续提供服务
+func WithGracefulRestart(enabled bool) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.gracefulRestart = enabled
+	})
+}
+
 // WithReleaseMode 开启发行版本枢纽
 func WithReleaseMode(release bool) IEngine {
 	return newSetupEngine(func(engine *Engine) {
@@ -113,6 +435,87 @@ func WithReleaseMode(release bool) IEngine {
 	})
 }
 
+// WithMaxMultipartMemory 设置解析 multipart 表单时使用的最大内存枢纽
+func WithMaxMultipartMemory(size int64) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		if size > 0 {
+			engine.maxMultipartMemory = size
+		}
+	})
+}
+
+// WithHTTPSRedirect 使用 RunTLS 时在 addr 开启 HTTP 服务, 将所有请求重定向到 HTTPS 枢纽
+func WithHTTPSRedirect(addr string) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.httpsRedirectAddr = addr
+	})
+}
+
+// WithReadTimeout 设置读取整个请求(包括请求体)的超时时间枢纽
+func WithReadTimeout(timeout time.Duration) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.serverConf.readTimeout = timeout
+	})
+}
+
+// WithReadHeaderTimeout 设置读取请求头的超时时间枢纽
+func WithReadHeaderTimeout(timeout time.Duration) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.serverConf.readHeaderTimeout = timeout
+	})
+}
+
+// WithWriteTimeout 设置写回响应的超时时间枢纽, 使用 WebSocket 或者长时间推送时应保持为 0
+func WithWriteTimeout(timeout time.Duration) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.serverConf.writeTimeout = timeout
+	})
+}
+
+// WithIdleTimeout 设置 keep-alive 连接等待下一个请求的超时时间枢纽
+func WithIdleTimeout(timeout time.Duration) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.serverConf.idleTimeout = timeout
+	})
+}
+
+// WithMaxHeaderBytes 设置请求头的最大字节数枢纽
+func WithMaxHeaderBytes(size int) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.serverConf.maxHeaderBytes = size
+	})
+}
+
+// WithErrorLog 设置 http.Server 内部错误的日志输出枢纽
+func WithErrorLog(logger *log.Logger) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.serverConf.errorLog = logger
+	})
+}
+
+// WithKeepAlives 是否开启 HTTP keep-alive 枢纽, 默认开启
+func WithKeepAlives(enabled bool) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.serverConf.disableKeepAlives = !enabled
+	})
+}
+
+// WithConnState 设置连接状态变化时的回调枢纽, 可以用于统计连接数
+func WithConnState(f func(net.Conn, http.ConnState)) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.serverConf.connState = f
+	})
+}
+
+// WithLog 设置框架内部使用的日志枢纽, 路由注册, 请求日志, 异常恢复以及服务启停的信息都会输出到该日志
+func WithLog(logger Log) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		if logger != nil {
+			engine.logger = logger
+		}
+	})
+}
+
 // WithMiddlewares 自定义全局中间件枢纽
 func WithMiddlewares(middlewares ...HandlerFunc) IEngine {
 	return newSetupEngine(func(engine *Engine) {
@@ -127,6 +530,12 @@ func newSetupEngine(f func(*Engine)) *setupEngine {
 // Default 自动化配置
 func Default(ies ...IEngine) *Engine {
 	engine := New()
+	engine.serverConf = serverConfig{
+		readTimeout:       defaultReadTimeout,
+		readHeaderTimeout: defaultReadHeaderTimeout,
+		idleTimeout:       defaultIdleTimeout,
+		maxHeaderBytes:    defaultMaxHeaderBytes,
+	}
 
 	for _, ie := range ies {
 		ie.Apply(engine)
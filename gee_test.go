@@ -1,9 +1,15 @@
 package gee
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func newTestRouter() *router {
@@ -45,3 +51,218 @@ func TestFindRoute(t *testing.T) {
 
 	fmt.Printf("matched path: %s, params['name']: %s\n", n.pattern, ps["name"])
 }
+
+func TestRunListener(t *testing.T) {
+	r := Default(WithReleaseMode(true), WithMiddlewares(Recover()))
+	r.GET("/ping", func(c *Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- r.RunListener(listener) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "pong" {
+		t.Fatalf("body = %q", body)
+	}
+
+	_ = listener.Close()
+	if err = <-done; err == nil {
+		t.Fatal("RunListener should return error after listener closed")
+	}
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		tlsAddr, method, target, want string
+		code                          int
+	}{
+		{":443", http.MethodGet, "http://example.com/a?b=1", "https://example.com/a?b=1", http.StatusMovedPermanently},
+		{":8443", http.MethodGet, "http://example.com:8080/a", "https://example.com:8443/a", http.StatusMovedPermanently},
+		{":443", http.MethodPost, "http://example.com/a", "https://example.com/a", http.StatusPermanentRedirect},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		httpsRedirectHandler(tt.tlsAddr).ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+		if w.Code != tt.code || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s %s: status = %d, location = %q", tt.method, tt.target, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestEngineShutdown(t *testing.T) {
+	r := Default(WithExitOp(true), WithReleaseMode(true), WithShutdownTimeout(time.Second),
+		WithMiddlewares(Recover()))
+	var order []string
+	r.OnShutdown(func(ctx context.Context) error {
+		order = append(order, "cache")
+		return nil
+	}, func(ctx context.Context) error {
+		order = append(order, "db")
+		return nil
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- r.RunListener(listener) }()
+
+	// 等待服务开始处理请求
+	for i := 0; i < 50; i++ {
+		if resp, err := http.Get("http://" + listener.Addr().String()); err == nil {
+			_ = resp.Body.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err = r.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatalf("RunListener should return nil after Shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RunListener should return after Shutdown")
+	}
+	if len(order) != 2 || order[0] != "cache" || order[1] != "db" {
+		t.Fatalf("shutdown hooks order = %v", order)
+	}
+}
+
+func TestShutdownBeforeServe(t *testing.T) {
+	r := Default(WithReleaseMode(true), WithMiddlewares(Recover()))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	// 不等待服务启动就调用 Shutdown, 服务注册之前的 Shutdown 也不能丢失
+	go func() { done <- r.RunListener(listener) }()
+	if err = r.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatalf("RunListener should return nil after Shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RunListener should return after an early Shutdown")
+	}
+	if conn, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		_ = conn.Close()
+		t.Fatal("listener should be closed after Shutdown")
+	}
+	if err = r.Run("127.0.0.1:0"); err != nil {
+		t.Fatalf("Run after Shutdown should return nil, got %v", err)
+	}
+}
+
+func TestRunReturnsListenError(t *testing.T) {
+	r := Default(WithExitOp(true), WithReleaseMode(true), WithMiddlewares(Recover()))
+	done := make(chan error, 1)
+	go func() { done <- r.Run("127.0.0.1:-1") }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Run should return listen error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run should not wait for signal after listen failed")
+	}
+}
+
+func TestServerOptions(t *testing.T) {
+	connState := func(net.Conn, http.ConnState) {}
+	r := Default(WithReadTimeout(time.Second), WithWriteTimeout(2*time.Second),
+		WithMaxHeaderBytes(4096), WithKeepAlives(false), WithConnState(connState))
+	srv := r.newServer(":0")
+	if srv.ReadTimeout != time.Second || srv.WriteTimeout != 2*time.Second || srv.MaxHeaderBytes != 4096 {
+		t.Fatalf("server options not applied: %+v", srv)
+	}
+	// 未设置的选项保持 Default 中的安全配置
+	if srv.ReadHeaderTimeout != defaultReadHeaderTimeout || srv.IdleTimeout != defaultIdleTimeout {
+		t.Fatalf("default timeouts not applied: %+v", srv)
+	}
+	if srv.ConnState == nil {
+		t.Fatal("ConnState hook not applied")
+	}
+
+	// New 保持 http.Server 的默认行为
+	if srv = New().newServer(":0"); srv.ReadHeaderTimeout != 0 || srv.ReadTimeout != 0 {
+		t.Fatalf("New should not set timeouts: %+v", srv)
+	}
+}
+
+func TestRunMulti(t *testing.T) {
+	api := Default(WithReleaseMode(true), WithMiddlewares(Recover()))
+	api.GET("/name", func(c *Context) {
+		c.String(http.StatusOK, "api")
+	})
+	admin := Default(WithReleaseMode(true), WithMiddlewares(Recover()))
+	admin.GET("/name", func(c *Context) {
+		c.String(http.StatusOK, "admin")
+	})
+
+	// 先占用端口再释放, 得到两个可用的地址
+	addrs := make([]string, 2)
+	for i := range addrs {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs[i] = l.Addr().String()
+		_ = l.Close()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- api.RunMulti(Endpoint{Addr: addrs[0]}, Endpoint{Addr: addrs[1], Engine: admin})
+	}()
+
+	want := []string{"api", "admin"}
+	for i, addr := range addrs {
+		var body []byte
+		for j := 0; j < 50; j++ {
+			resp, err := http.Get("http://" + addr + "/name")
+			if err == nil {
+				body, _ = io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if string(body) != want[i] {
+			t.Fatalf("%s body = %q, want %q", addr, body, want[i])
+		}
+	}
+
+	if err := api.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("RunMulti should return nil after Shutdown, got %v", err)
+	}
+	if _, err := http.Get("http://" + addrs[1] + "/name"); err == nil {
+		t.Fatal("admin server should be closed by shared Shutdown")
+	}
+
+	// 任意一个地址监听失败时直接返回错误
+	if err := api.RunMulti(Endpoint{Addr: "127.0.0.1:0"}, Endpoint{Addr: "127.0.0.1:-1"}); err == nil {
+		t.Fatal("RunMulti should return listen error")
+	}
+}
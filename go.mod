@@ -2,13 +2,16 @@ module github.com/ws-cczj/gee
 
 go 1.19
 
-require github.com/go-playground/validator/v10 v10.12.0
+require (
+	github.com/go-playground/validator/v10 v10.12.0
+	golang.org/x/net v0.23.0
+)
 
 require (
 	github.com/go-playground/locales v0.14.1 // indirect
 	github.com/go-playground/universal-translator v0.18.1 // indirect
 	github.com/leodido/go-urn v1.2.2 // indirect
-	golang.org/x/crypto v0.7.0 // indirect
-	golang.org/x/sys v0.6.0 // indirect
-	golang.org/x/text v0.8.0 // indirect
+	golang.org/x/crypto v0.21.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
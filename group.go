@@ -1,7 +1,6 @@
 package gee
 
 import (
-	"fmt"
 	"net/http"
 	"path"
 )
@@ -21,7 +20,7 @@ func (rg *RouterGroup) Use(middlewares ...HandlerFunc) {
 func (rg *RouterGroup) addRoute(method, comp string, handlers ...HandlerFunc) {
 	pattern := rg.prefix + comp
 	if !rg.engine.releaseMode {
-		_, _ = fmt.Printf("[GEE] %v |Route %4s-%s\n", getCurrentTime(), method, pattern)
+		rg.engine.logger.Debug("route", "method", method, "path", pattern)
 	}
 	rg.engine.router.addRoute(method, pattern, handlers...)
 }
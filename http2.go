@@ -0,0 +1,52 @@
+package gee
+
+import (
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net/http"
+	"time"
+)
+
+// HTTP2Config HTTP/2 的相关配置, 零值表示使用 http2 包的默认值
+type HTTP2Config struct {
+	MaxConcurrentStreams         uint32        // 每个连接允许同时打开的最大流数量
+	MaxReadFrameSize             uint32        // 允许读取的最大帧大小
+	MaxUploadBufferPerConnection int32         // 每个连接的上传窗口大小
+	MaxUploadBufferPerStream     int32         // 每个流的上传窗口大小
+	IdleTimeout                  time.Duration // 空闲连接的超时时间
+}
+
+// WithH2C 开启 h2c 枢纽, 在没有 TLS 的情况下支持 HTTP/2, 包括 prior knowledge 和 Upgrade 两种方式
+func WithH2C(enabled bool) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.h2c = enabled
+	})
+}
+
+// WithHTTP2 设置 HTTP/2 配置枢纽, 对 RunTLS 以及开启 h2c 之后的服务生效
+func WithHTTP2(conf HTTP2Config) IEngine {
+	return newSetupEngine(func(engine *Engine) {
+		engine.http2Conf = &conf
+	})
+}
+
+// configureHTTP2 根据 Engine 的配置为 srv 开启 HTTP/2
+func (engine *Engine) configureHTTP2(srv *http.Server) {
+	if engine.http2Conf == nil && !engine.h2c {
+		return
+	}
+
+	h2s := &http2.Server{}
+	if conf := engine.http2Conf; conf != nil {
+		h2s.MaxConcurrentStreams = conf.MaxConcurrentStreams
+		h2s.MaxReadFrameSize = conf.MaxReadFrameSize
+		h2s.MaxUploadBufferPerConnection = conf.MaxUploadBufferPerConnection
+		h2s.MaxUploadBufferPerStream = conf.MaxUploadBufferPerStream
+		h2s.IdleTimeout = conf.IdleTimeout
+		// 对 TLS 连接生效, 通过 ALPN 协商 h2 时使用该配置
+		_ = http2.ConfigureServer(srv, h2s)
+	}
+	if engine.h2c {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	}
+}
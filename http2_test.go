@@ -0,0 +1,69 @@
+package gee
+
+import (
+	"context"
+	"crypto/tls"
+	"golang.org/x/net/http2"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newProtoEngine(ies ...IEngine) *Engine {
+	r := Default(append(ies, WithReleaseMode(true), WithMiddlewares(Recover()))...)
+	r.GET("/proto", func(c *Context) {
+		c.String(http.StatusOK, c.Req.Proto)
+	})
+	return r
+}
+
+func getBody(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	r := newProtoEngine(WithH2C(true))
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config = r.newServer("")
+	ts.Start()
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	if proto := getBody(t, client, ts.URL+"/proto"); proto != "HTTP/2.0" {
+		t.Fatalf("proto = %q, want HTTP/2.0", proto)
+	}
+	// 普通的 HTTP/1.1 客户端仍然可以访问
+	if proto := getBody(t, http.DefaultClient, ts.URL+"/proto"); proto != "HTTP/1.1" {
+		t.Fatalf("proto = %q, want HTTP/1.1", proto)
+	}
+}
+
+func TestHTTP2WithTLS(t *testing.T) {
+	r := newProtoEngine(WithHTTP2(HTTP2Config{MaxConcurrentStreams: 10}))
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config = r.newServer("")
+	if ts.Config.TLSNextProto[http2.NextProtoTLS] == nil {
+		t.Fatal("HTTP/2 should be configured for TLS")
+	}
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	if proto := getBody(t, ts.Client(), ts.URL+"/proto"); proto != "HTTP/2.0" {
+		t.Fatalf("proto = %q, want HTTP/2.0", proto)
+	}
+}
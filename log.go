@@ -0,0 +1,161 @@
+package gee
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log 框架内部使用的日志接口, keysAndValues 为成对出现的键和值, 比如:
+//
+//	log.Info("route registered", "method", "GET", "path", "/ping")
+//
+// 通过 WithLog 可以替换为自己的实现, 将日志统一输出到其他日志库中
+type Log interface {
+	Debug(msg string, keysAndValues ...any)
+	Info(msg string, keysAndValues ...any)
+	Warn(msg string, keysAndValues ...any)
+	Error(msg string, keysAndValues ...any)
+}
+
+// LogLevel 日志级别, 低于设置级别的日志不会输出
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelSilent // 不输出任何日志
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "SILENT"
+	}
+}
+
+// defaultLog 没有通过 WithLog 设置日志时使用
+var defaultLog = NewLog(os.Stdout, LevelDebug)
+
+// textLog 以 "[GEE] 时间 |级别| 消息 key=value" 的格式输出日志
+type textLog struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level LogLevel
+}
+
+// NewLog 创建输出到 out 的文本日志
+func NewLog(out io.Writer, level LogLevel) Log {
+	return &textLog{out: out, level: level}
+}
+
+func (l *textLog) Debug(msg string, keysAndValues ...any) { l.log(LevelDebug, msg, keysAndValues) }
+func (l *textLog) Info(msg string, keysAndValues ...any)  { l.log(LevelInfo, msg, keysAndValues) }
+func (l *textLog) Warn(msg string, keysAndValues ...any)  { l.log(LevelWarn, msg, keysAndValues) }
+func (l *textLog) Error(msg string, keysAndValues ...any) { l.log(LevelError, msg, keysAndValues) }
+
+func (l *textLog) log(level LogLevel, msg string, keysAndValues []any) {
+	if level < l.level {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[GEE] %v |%-5s| %s", getCurrentTime(), level, msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, val := logPair(keysAndValues, i)
+		s := fmt.Sprint(val)
+		if strings.ContainsAny(s, " =\"") && !strings.Contains(s, "\n") {
+			s = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, s)
+	}
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	_, _ = io.WriteString(l.out, b.String())
+	l.mu.Unlock()
+}
+
+// jsonLog 每条日志输出为一行 JSON
+type jsonLog struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level LogLevel
+}
+
+// NewJSONLog 创建输出到 out 的 JSON 日志, 每条日志一行, 包含 time, level, msg 以及所有键值
+func NewJSONLog(out io.Writer, level LogLevel) Log {
+	return &jsonLog{out: out, level: level}
+}
+
+func (l *jsonLog) Debug(msg string, keysAndValues ...any) { l.log(LevelDebug, msg, keysAndValues) }
+func (l *jsonLog) Info(msg string, keysAndValues ...any)  { l.log(LevelInfo, msg, keysAndValues) }
+func (l *jsonLog) Warn(msg string, keysAndValues ...any)  { l.log(LevelWarn, msg, keysAndValues) }
+func (l *jsonLog) Error(msg string, keysAndValues ...any) { l.log(LevelError, msg, keysAndValues) }
+
+func (l *jsonLog) log(level LogLevel, msg string, keysAndValues []any) {
+	if level < l.level {
+		return
+	}
+	// 手动拼接以保证字段的顺序与调用时一致
+	var b strings.Builder
+	b.WriteString(`{"time":`)
+	writeJSONValue(&b, time.Now().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSONValue(&b, strings.ToLower(level.String()))
+	b.WriteString(`,"msg":`)
+	writeJSONValue(&b, msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, val := logPair(keysAndValues, i)
+		b.WriteByte(',')
+		writeJSONValue(&b, key)
+		b.WriteByte(':')
+		writeJSONValue(&b, val)
+	}
+	b.WriteString("}\n")
+
+	l.mu.Lock()
+	_, _ = io.WriteString(l.out, b.String())
+	l.mu.Unlock()
+}
+
+func writeJSONValue(b *strings.Builder, val any) {
+	switch v := val.(type) {
+	case error:
+		val = v.Error()
+	case time.Duration:
+		val = v.String()
+	case fmt.Stringer:
+		val = v.String()
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(val))
+	}
+	b.Write(data)
+}
+
+// logPair 取出第 i 个键值对, 键不是字符串或者缺少值时进行兼容处理
+func logPair(keysAndValues []any, i int) (key string, val any) {
+	if i+1 >= len(keysAndValues) {
+		return "EXTRA", keysAndValues[i]
+	}
+	key, ok := keysAndValues[i].(string)
+	if !ok {
+		key = fmt.Sprint(keysAndValues[i])
+	}
+	return key, keysAndValues[i+1]
+}
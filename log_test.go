@@ -0,0 +1,67 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTextLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLog(&buf, LevelInfo)
+	l.Debug("hidden")
+	l.Info("request", "path", "/a b", "status", 200)
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Fatal("debug log should be filtered by level")
+	}
+	if !strings.Contains(out, `|INFO | request path="/a b" status=200`) {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestJSONLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewJSONLog(&buf, LevelDebug)
+	l.Error("listen is fail", "err", errors.New("boom"), "port", 80, "dangling")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("output should be valid json: %v, %q", err, buf.String())
+	}
+	if entry["level"] != "error" || entry["msg"] != "listen is fail" || entry["err"] != "boom" ||
+		entry["port"] != float64(80) || entry["EXTRA"] != "dangling" {
+		t.Fatalf("unexpected entry: %v", entry)
+	}
+}
+
+func TestWithLog(t *testing.T) {
+	var buf bytes.Buffer
+	r := Default(WithLog(NewJSONLog(&buf, LevelDebug)), WithMiddlewares(Logger(), Recover()))
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{"route", "panic recovered", "request"}
+	if len(lines) != len(want) {
+		t.Fatalf("log lines = %q", lines)
+	}
+	for i, line := range lines {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry["msg"] != want[i] {
+			t.Fatalf("line %d = %q, want msg %q", i, line, want[i])
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package gee
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	green   = "\033[97;42m"
+	white   = "\033[90;47m"
+	yellow  = "\033[90;43m"
+	red     = "\033[97;41m"
+	blue    = "\033[97;44m"
+	magenta = "\033[97;45m"
+	cyan    = "\033[97;46m"
+	reset   = "\033[0m"
+)
+
+// ColorMode 请求日志的颜色模式
+type ColorMode int
+
+const (
+	ColorAuto    ColorMode = iota // Output 为终端时输出颜色
+	ColorForce                    // 总是输出颜色
+	ColorDisable                  // 从不输出颜色
+)
+
+// LogFormatterParams 传递给 LogFormatter 的请求信息
+type LogFormatterParams struct {
+	Request    *http.Request
+	TimeStamp  time.Time // 请求处理完成的时间
+	StatusCode int
+	Latency    time.Duration
+	ClientIP   string
+	Method     string
+	Path       string
+	RawQuery   string
+	BodySize   int    // 响应体字节数
+	RequestID  string // 请求 ID, 优先使用 RequestID 中间件设置的 ID, 其次是响应头或者请求头中的 X-Request-ID
+	Keys       map[string]any
+
+	isTerm bool
+}
+
+// StatusCodeColor 状态码对应的颜色
+func (p *LogFormatterParams) StatusCodeColor() string {
+	return getStatusColor(p.StatusCode)
+}
+
+// MethodColor 请求方法对应的颜色
+func (p *LogFormatterParams) MethodColor() string {
+	return getMethodColor(p.Method)
+}
+
+// ResetColor 重置颜色
+func (p *LogFormatterParams) ResetColor() string {
+	return reset
+}
+
+// IsOutputColor 是否需要输出颜色
+func (p *LogFormatterParams) IsOutputColor() bool {
+	return p.isTerm
+}
+
+// LogFormatter 将一次请求格式化为一行日志
+type LogFormatter func(params LogFormatterParams) string
+
+// LoggerConfig 请求日志中间件的配置
+type LoggerConfig struct {
+	// Output 日志输出, 与 Formatter 都为空时使用 Engine 的 Log 输出结构化日志
+	Output io.Writer
+	// Formatter 日志格式, 为空时使用 DefaultLogFormatter
+	Formatter LogFormatter
+	// SkipPaths 不记录日志的路径, 比如健康检查
+	SkipPaths []string
+	// Skip 返回 true 时不记录日志
+	Skip func(c *Context) bool
+	// Color 颜色模式, 默认 Output 为终端时才输出颜色
+	Color ColorMode
+}
+
+// Logger 请求日志中间件, 使用 Engine 的 Log 输出
+func Logger() HandlerFunc {
+	return LoggerWithConfig(LoggerConfig{})
+}
+
+// LoggerWithWriter 将请求日志以默认格式输出到 out
+func LoggerWithWriter(out io.Writer, skipPaths ...string) HandlerFunc {
+	return LoggerWithConfig(LoggerConfig{Output: out, SkipPaths: skipPaths})
+}
+
+// LoggerWithConfig 根据配置创建请求日志中间件。
+// 使用 Engine 的 Log 时和之前一样只在非发行版本输出, 指定了 Output 或 Formatter 时总是输出
+func LoggerWithConfig(conf LoggerConfig) HandlerFunc {
+	useEngineLog := conf.Output == nil && conf.Formatter == nil
+	out := conf.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	formatter := conf.Formatter
+	if formatter == nil {
+		formatter = DefaultLogFormatter
+	}
+	isTerm := conf.Color == ColorForce || (conf.Color == ColorAuto && isTerminal(out))
+
+	skip := make(map[string]struct{}, len(conf.SkipPaths))
+	for _, p := range conf.SkipPaths {
+		skip[p] = struct{}{}
+	}
+
+	return func(c *Context) {
+		start := time.Now()
+		path := c.Req.URL.Path
+		c.Next()
+
+		if _, ok := skip[path]; ok {
+			return
+		}
+		if conf.Skip != nil && conf.Skip(c) {
+			return
+		}
+		if useEngineLog && c.engine != nil && c.engine.releaseMode {
+			return
+		}
+
+		params := newLogFormatterParams(c, start, path)
+		if useEngineLog {
+			kvs := []any{
+				"method", params.Method,
+				"path", params.Path,
+				"status", params.StatusCode,
+				"latency", params.Latency,
+				"query", params.RawQuery,
+				"ip", params.ClientIP,
+				"user_agent", c.Req.UserAgent(),
+				"bytes", params.BodySize,
+			}
+			if params.RequestID != "" {
+				kvs = append(kvs, "request_id", params.RequestID)
+			}
+			c.log().Info("request", kvs...)
+			return
+		}
+		params.isTerm = isTerm
+		_, _ = io.WriteString(out, formatter(params))
+	}
+}
+
+func newLogFormatterParams(c *Context, start time.Time, path string) LogFormatterParams {
+	now := time.Now()
+	status := c.StatusCode
+	if status == 0 && c.rw != nil {
+		status = c.rw.status
+	}
+	requestID := c.RequestID()
+	if requestID == "" {
+		requestID = c.Writer.Header().Get(RequestIDHeader)
+	}
+	if requestID == "" {
+		requestID = c.GetHeader(RequestIDHeader)
+	}
+	c.mu.RLock()
+	keys := c.Keys
+	c.mu.RUnlock()
+	return LogFormatterParams{
+		Request:    c.Req,
+		TimeStamp:  now,
+		StatusCode: status,
+		Latency:    now.Sub(start),
+		ClientIP:   c.ClientIP(),
+		Method:     c.Req.Method,
+		Path:       path,
+		RawQuery:   c.Req.URL.RawQuery,
+		BodySize:   c.BodySize(),
+		RequestID:  requestID,
+		Keys:       keys,
+	}
+}
+
+// DefaultLogFormatter 默认的请求日志格式
+func DefaultLogFormatter(p LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if p.IsOutputColor() {
+		statusColor, methodColor, resetColor = p.StatusCodeColor(), p.MethodColor(), p.ResetColor()
+	}
+	return fmt.Sprintf("[GEE] %v |%s %s %s| %s |%13v |%s %3d %s| %s  msg:{ip: %s, user-agent: %s}\n",
+		p.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		methodColor, p.Method, resetColor,
+		p.Path,
+		p.Latency,
+		statusColor, p.StatusCode, resetColor,
+		p.RawQuery,
+		p.ClientIP,
+		p.Request.UserAgent())
+}
+
+// CombinedLogFormatter Apache Combined 日志格式
+func CombinedLogFormatter(p LogFormatterParams) string {
+	user := "-"
+	if p.Request.URL.User != nil && p.Request.URL.User.Username() != "" {
+		user = p.Request.URL.User.Username()
+	} else if name, _, ok := p.Request.BasicAuth(); ok && name != "" {
+		user = name
+	}
+	size := "-"
+	if p.BodySize > 0 {
+		size = fmt.Sprint(p.BodySize)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		p.ClientIP,
+		user,
+		p.TimeStamp.Format("02/Jan/2006:15:04:05 -0700"),
+		p.Method, p.Request.URL.RequestURI(), p.Request.Proto,
+		p.StatusCode,
+		size,
+		p.Request.Referer(),
+		p.Request.UserAgent())
+}
+
+// JSONLogFormatter 每个请求输出一行 JSON, 包含延迟, 响应大小和请求 ID
+func JSONLogFormatter(p LogFormatterParams) string {
+	var b strings.Builder
+	b.WriteString(`{"time":`)
+	writeJSONValue(&b, p.TimeStamp.Format(time.RFC3339Nano))
+	fields := []any{
+		"method", p.Method,
+		"path", p.Path,
+		"query", p.RawQuery,
+		"status", p.StatusCode,
+		"latency_ms", float64(p.Latency.Microseconds()) / 1000,
+		"bytes", p.BodySize,
+		"ip", p.ClientIP,
+		"user_agent", p.Request.UserAgent(),
+		"request_id", p.RequestID,
+	}
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteByte(',')
+		writeJSONValue(&b, fields[i])
+		b.WriteByte(':')
+		writeJSONValue(&b, fields[i+1])
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// isTerminal 判断 out 是否为终端, 设置了 NO_COLOR 环境变量时总是返回 false
+func isTerminal(out io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func getCurrentTime() string {
+	return time.Now().Format("2006/01/02 - 15:04:05")
+}
+
+func getStatusColor(code int) string {
+	color := cyan
+	// 记录异常信息
+	switch {
+	case code < 300:
+		color = green
+	case code < 400:
+		color = yellow
+	case code < 500:
+		color = red
+	case code < 600:
+		color = red
+	default:
+	}
+	return color
+}
+
+func getMethodColor(method string) string {
+	color := cyan
+	switch method {
+	case http.MethodGet:
+		color = green
+	case http.MethodPost:
+		color = blue
+	case http.MethodDelete:
+		color = red
+	case http.MethodPut:
+		color = magenta
+	default:
+	}
+	return color
+}
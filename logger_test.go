@@ -0,0 +1,68 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newLoggerEngine(conf LoggerConfig) *Engine {
+	r := Default(WithReleaseMode(true), WithMiddlewares(LoggerWithConfig(conf)))
+	r.GET("/hello", func(c *Context) {
+		c.Header("X-Request-ID", "req-1")
+		c.String(http.StatusOK, "hello")
+	})
+	r.GET("/health", func(c *Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func TestLoggerWithConfigFormats(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLoggerEngine(LoggerConfig{Output: &buf, Formatter: JSONLogFormatter, SkipPaths: []string{"/health"}})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hello?a=1", nil))
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("should only log /hello as one json line: %v, %q", err, buf.String())
+	}
+	if entry["path"] != "/hello" || entry["status"] != float64(200) || entry["bytes"] != float64(5) ||
+		entry["request_id"] != "req-1" || entry["query"] != "a=1" {
+		t.Fatalf("unexpected entry: %v", entry)
+	}
+
+	buf.Reset()
+	r = newLoggerEngine(LoggerConfig{Output: &buf, Formatter: CombinedLogFormatter})
+	req := httptest.NewRequest(http.MethodGet, "/hello?a=1", nil)
+	req.Header.Set("Referer", "http://example.com")
+	req.SetBasicAuth("gee", "pwd")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if line := buf.String(); !strings.Contains(line, ` - gee [`) ||
+		!strings.Contains(line, `] "GET /hello?a=1 HTTP/1.1" 200 5 "http://example.com" ""`) {
+		t.Fatalf("unexpected combined line: %q", line)
+	}
+}
+
+func TestLoggerWithConfigColor(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLoggerEngine(LoggerConfig{Output: &buf, Skip: func(c *Context) bool {
+		return c.Req.URL.Path == "/health"
+	}})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hello", nil))
+	if strings.Count(buf.String(), "\n") != 1 || strings.Contains(buf.String(), "\033[") {
+		t.Fatalf("non terminal output should not contain color: %q", buf.String())
+	}
+
+	buf.Reset()
+	r = newLoggerEngine(LoggerConfig{Output: &buf, Color: ColorForce})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hello", nil))
+	if !strings.Contains(buf.String(), green) {
+		t.Fatalf("forced color output should contain color: %q", buf.String())
+	}
+}
@@ -1,87 +1,97 @@
 package gee
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httputil"
 	"runtime"
 	"strings"
-	"time"
+	"syscall"
 )
 
-const (
-	green   = "\033[97;42m"
-	white   = "\033[90;47m"
-	yellow  = "\033[90;43m"
-	red     = "\033[97;41m"
-	blue    = "\033[97;44m"
-	magenta = "\033[97;45m"
-	cyan    = "\033[97;46m"
-	reset   = "\033[0m"
-)
-
-func Logger() HandlerFunc {
-	return func(c *Context) {
-		start := time.Now()
-		c.Next()
-
-		cost := time.Since(start)
-		if !c.engine.releaseMode {
-			_, _ = fmt.Printf("[GEE] %v |%s %s %s| %s |%13v |%s %3d %s| %s  msg:{ip: %s, user-agent: %s}\n",
-				getCurrentTime(),
-				getMethodColor(c.Req.Method), c.Req.Method, reset,
-				c.Req.URL.Path,
-				cost,
-				getStatusColor(c.StatusCode), c.StatusCode, reset,
-				c.Req.URL.RawQuery,
-				c.ClientIP(),
-				c.Req.UserAgent())
-		}
-	}
+// RecoveryConfig 异常恢复中间件的配置
+type RecoveryConfig struct {
+	// Output 异常信息的输出, 为空时使用 Engine 的 Log
+	Output io.Writer
+	// Handler 自定义异常响应, 为空时如果还没有写回响应则返回 500
+	Handler func(c *Context, err any)
+	// SensitiveHeaders 输出请求信息时需要隐藏的请求头, 为空时使用 defaultSensitiveHeaders
+	SensitiveHeaders []string
 }
 
-func getCurrentTime() string {
-	return time.Now().Format("2006/01/02 - 15:04:05")
-}
+// defaultSensitiveHeaders 默认隐藏的请求头
+var defaultSensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key", "X-Auth-Token"}
 
-func getStatusColor(code int) string {
-	color := cyan
-	// 记录异常信息
-	switch {
-	case code < 300:
-		color = green
-	case code < 400:
-		color = yellow
-	case code < 500:
-		color = red
-	case code < 600:
-		color = red
-	default:
-	}
-	return color
+// Recover 异常恢复中间件
+func Recover() HandlerFunc {
+	return RecoveryWithConfig(RecoveryConfig{})
 }
 
-func getMethodColor(method string) string {
-	color := cyan
-	switch method {
-	case http.MethodGet:
-		color = green
-	case http.MethodPost:
-		color = blue
-	case http.MethodDelete:
-		color = red
-	case http.MethodPut:
-		color = magenta
-	default:
+// RecoveryWithConfig 根据配置创建异常恢复中间件。
+// http.ErrAbortHandler 会被重新抛出交给 http.Server 处理;
+// 客户端断开连接(broken pipe)时只记录日志, 不再尝试写回响应
+func RecoveryWithConfig(conf RecoveryConfig) HandlerFunc {
+	sensitive := conf.SensitiveHeaders
+	if len(sensitive) == 0 {
+		sensitive = defaultSensitiveHeaders
 	}
-	return color
-}
-
-// Recover 异常恢复中间件
-func Recover() HandlerFunc {
 	return func(c *Context) {
 		defer func() {
-			if err := recover(); err != nil {
-				_, _ = fmt.Printf("%s\n\n", trace(fmt.Sprintf("%s", err)))
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			brokenPipe := isBrokenPipe(err)
+			request := dumpRequest(c.Req, sensitive)
+			var (
+				frames []stackFrame
+				stack  string
+			)
+			if !brokenPipe {
+				frames = callers(3) // 从 panic 开始记录
+				stack = formatTrace(fmt.Sprintf("%s", err), frames)
+			}
+			requestID := c.RequestID()
+			if conf.Output != nil {
+				prefix := "[Recovery]"
+				if requestID != "" {
+					prefix += " request_id=" + requestID
+				}
+				_, _ = fmt.Fprintf(conf.Output, "%s %v panic recovered: %v\n%s\n%s\n\n",
+					prefix, getCurrentTime(), err, request, stack)
+			} else {
+				kvs := []any{"err", err, "request", request}
+				if requestID != "" {
+					kvs = append(kvs, "request_id", requestID)
+				}
+				if brokenPipe {
+					c.log().Error("connection broken", kvs...)
+				} else {
+					c.log().Error("panic recovered", append(kvs, "trace", stack)...)
+				}
+			}
+
+			switch {
+			case brokenPipe:
+				c.Abort()
+			case conf.Handler != nil:
+				conf.Handler(c, err)
+				c.Abort()
+			case responseWritten(c):
+				// 响应头已经写回, 无法再修改状态码
+				c.Abort()
+			case c.engine != nil && !c.engine.releaseMode && acceptsHTML(c.Req):
+				// 非发行版本返回带有调用栈和请求信息的调试页面
+				renderDebugPage(c, err, frames, sensitive)
+				c.Abort()
+			default:
 				c.AbortWithJson(http.StatusInternalServerError, "Internal Server Error")
 			}
 		}()
@@ -90,49 +100,113 @@ func Recover() HandlerFunc {
 	}
 }
 
-// print stack trace for debug
-func trace(message string) string {
+// responseWritten 处理链是否已经写回了响应头。中间件包装的 Writer 可能还缓冲着响应,
+// 因此优先询问 c.Writer, 没有实现 Written 时使用最底层的 Writer
+func responseWritten(c *Context) bool {
+	if w, ok := c.Writer.(interface{ Written() bool }); ok {
+		return w.Written()
+	}
+	return c.rw != nil && c.rw.Written()
+}
+
+// isBrokenPipe 判断 panic 是否由于客户端断开连接导致
+func isBrokenPipe(err any) bool {
+	e, ok := err.(error)
+	if !ok {
+		return false
+	}
+	var opErr *net.OpError
+	if !errors.As(e, &opErr) {
+		return false
+	}
+	if errors.Is(opErr, syscall.EPIPE) || errors.Is(opErr, syscall.ECONNRESET) {
+		return true
+	}
+	msg := strings.ToLower(opErr.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
+
+// dumpRequest 输出请求行和请求头, 敏感的请求头会被隐藏
+func dumpRequest(req *http.Request, sensitive []string) string {
+	if req == nil {
+		return ""
+	}
+	r := req.Clone(req.Context())
+	for _, h := range sensitive {
+		if r.Header.Get(h) != "" {
+			r.Header.Set(h, "[REDACTED]")
+		}
+	}
+	dump, err := httputil.DumpRequest(r, false)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(dump))
+}
+
+// stackFrame 调用栈中的一帧
+type stackFrame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// callers 获取当前的调用栈, skip 与 runtime.Callers 的含义相同
+func callers(skip int) []stackFrame {
 	var pcs [32]uintptr
-	n := runtime.Callers(3, pcs[:]) // skip first 3 caller
+	n := runtime.Callers(skip, pcs[:])
 
-	var build strings.Builder
-	build.Grow(2 + n)
-	build.WriteString(message)
-	build.WriteString("\nTraceback:")
+	frames := make([]stackFrame, 0, n)
 	for _, pc := range pcs[:n] {
 		fn := runtime.FuncForPC(pc)
 		file, line := fn.FileLine(pc)
-		build.WriteString(fmt.Sprintf("\n\t%s:%d", file, line))
+		frames = append(frames, stackFrame{Function: fn.Name(), File: file, Line: line})
+	}
+	return frames
+}
+
+// formatTrace 将异常信息和调用栈格式化为文本
+func formatTrace(message string, frames []stackFrame) string {
+	var build strings.Builder
+	build.Grow(2 + len(frames))
+	build.WriteString(message)
+	build.WriteString("\nTraceback:")
+	for _, f := range frames {
+		build.WriteString(fmt.Sprintf("\n\t%s:%d", f.File, f.Line))
 	}
 	return build.String()
 }
 
-// Cors 跨域中间件
-func Cors() HandlerFunc {
+// MaxUploadSize 限制请求体大小的中间件, 可以作为单个路由的处理函数使用。
+// Content-Length 超出限制时直接返回 413, 否则在读取超出限制时返回错误,
+// 如果处理函数没有写回响应, 则由该中间件补充 413 响应
+func MaxUploadSize(size int64) HandlerFunc {
 	return func(c *Context) {
-		method := c.Req.Method
-		origin := c.GetHeader("Origin")
-		// 如果origin为 "" 说明不是跨域，null 不等于 ""
-		if origin != "" {
-			// 必须，接受指定域的请求，可以使用*不加以限制，但不安全
-			//header.Set("Access-Control-Allow-Origin", "*")
-			c.Header("Access-Control-Allow-Origin", origin)
-			// 必须，设置服务器支持的所有跨域请求的方法
-			c.Header("Access-Control-Allow-Methods", "POST, GET, PUT, DELETE, OPTIONS")
-			// 服务器支持的所有头信息字段，不限于浏览器在"预检"中请求的字段
-			c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Token, Authorization")
-			// 可选，设置XMLHttpRequest的响应对象能拿到的额外字段
-			c.Header("Access-Control-Expose-Headers", "Access-Control-Allow-Headers, Token")
-			// 可选，是否允许后续请求携带认证信息Cookie，该值只能是true，不需要则不设置
-			c.Header("Access-Control-Allow-Credentials", "true")
-			// 说明这个请求是一个预请求，提前返回
-			if method == http.MethodOptions {
-				// 预请求最大缓存时间
-				c.Header("Access-Control-Max-Age", "86400")
-				c.AbortWithStatus(http.StatusNoContent)
-				return
-			}
+		if c.Req.ContentLength > size {
+			c.AbortWithJson(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+			return
 		}
+		body := &maxBytesBody{ReadCloser: http.MaxBytesReader(c.Writer, c.Req.Body, size)}
+		c.Req.Body = body
 		c.Next()
+
+		if body.exceeded && c.StatusCode == 0 {
+			c.AbortWithJson(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+		}
+	}
+}
+
+// maxBytesBody 记录请求体读取时是否超出了限制
+type maxBytesBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *maxBytesBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		b.exceeded = true
 	}
+	return
 }
@@ -1,8 +1,15 @@
 package gee
 
 import (
+	"bytes"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -33,3 +40,117 @@ func TestWithMiddlewares(t *testing.T) {
 
 	r.Run(":9999")
 }
+
+func TestRecoveryWithConfig(t *testing.T) {
+	var buf bytes.Buffer
+	r := Default(WithReleaseMode(true), WithMiddlewares(RecoveryWithConfig(RecoveryConfig{
+		Output: &buf,
+		Handler: func(c *Context, err any) {
+			c.String(http.StatusServiceUnavailable, "recovered: %v", err)
+		},
+	})))
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "recovered: boom" {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body.String())
+	}
+	out := buf.String()
+	if strings.Contains(out, "secret-token") || !strings.Contains(out, "Authorization: [REDACTED]") {
+		t.Fatalf("sensitive header should be redacted: %q", out)
+	}
+	if !strings.Contains(out, "Traceback:") {
+		t.Fatalf("output should contain stack trace: %q", out)
+	}
+}
+
+func TestRecoveryHeadersWritten(t *testing.T) {
+	r := Default(WithReleaseMode(true), WithLog(NewLog(io.Discard, LevelSilent)), WithMiddlewares(Recover()))
+	r.GET("/partial", func(c *Context) {
+		c.String(http.StatusOK, "partial")
+		panic("after write")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/partial", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Fatalf("response should not be overwritten, status = %d, body = %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRecoveryBrokenPipe(t *testing.T) {
+	var buf bytes.Buffer
+	r := Default(WithReleaseMode(true), WithMiddlewares(RecoveryWithConfig(RecoveryConfig{Output: &buf})))
+	r.GET("/pipe", func(c *Context) {
+		panic(&net.OpError{Op: "write", Err: &os.SyscallError{Syscall: "write", Err: syscall.EPIPE}})
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pipe", nil))
+	if w.Body.Len() != 0 {
+		t.Fatalf("should not write response to broken connection, body = %q", w.Body.String())
+	}
+	if strings.Contains(buf.String(), "Traceback:") {
+		t.Fatal("broken pipe should not print stack trace")
+	}
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	r := Default(WithReleaseMode(true), WithMiddlewares(Recover()))
+	r.GET("/abort", func(c *Context) {
+		panic(http.ErrAbortHandler)
+	})
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Fatalf("ErrAbortHandler should be re-panicked, got %v", err)
+		}
+	}()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+}
+
+func TestRecoveryDebugPage(t *testing.T) {
+	newEngine := func(release bool) *Engine {
+		r := Default(WithReleaseMode(release), WithLog(NewLog(io.Discard, LevelSilent)), WithMiddlewares(Recover()))
+		r.GET("/users/:id", func(c *Context) {
+			panic("debug <boom>")
+		})
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/users/42?tab=profile", nil)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Cookie", "session=secret")
+	newEngine(false).ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if w.Code != http.StatusInternalServerError || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("status = %d, content-type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		"debug &lt;boom&gt;",                  // panic 信息需要转义
+		"route /users/:id",                    // 路由
+		"<td>id</td><td>42</td>",              // 路径参数
+		"<td>tab</td><td>profile</td>",        // 查询参数
+		"middleware_test.go",                  // 调用栈
+		`panic(&#34;debug &lt;boom&gt;&#34;)`, // 源码片段
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("debug page should contain %q", want)
+		}
+	}
+	if !strings.Contains(body, "<td>Cookie</td><td>[REDACTED]</td>") {
+		t.Error("sensitive header should be redacted in debug page")
+	}
+
+	// 发行版本保持简单的响应
+	w = httptest.NewRecorder()
+	newEngine(true).ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), "<html>") {
+		t.Fatalf("release mode should not render debug page: %q", w.Body.String())
+	}
+}
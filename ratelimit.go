@@ -0,0 +1,383 @@
+package gee
+
+import (
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitAlgorithm 限流算法
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket 令牌桶, 容量为 Limit, 每个 Window 补满一次, 允许一定的突发流量
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow 滑动窗口, 任意 Window 时间内最多 Limit 个请求, 使用前后两个窗口的加权计数近似
+	SlidingWindow
+)
+
+// RateLimitRule 限流规则
+type RateLimitRule struct {
+	Algorithm RateLimitAlgorithm
+	Limit     int           // 令牌桶容量或者窗口内允许的请求数
+	Window    time.Duration // 令牌补满的时间或者窗口长度
+}
+
+// RateLimitResult 一次限流判断的结果
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // 距离额度完全恢复的时间
+	RetryAfter time.Duration // 被拒绝时距离下一次允许的时间
+}
+
+// Store 限流状态的存储, 实现需要保证同一个 key 的 Take 是原子的。
+// 需要多实例共享限流状态时可以基于 Redis 等实现
+type Store interface {
+	Take(key string, rule RateLimitRule, now time.Time) (RateLimitResult, error)
+}
+
+// RateLimitConfig 限流中间件的配置
+type RateLimitConfig struct {
+	RateLimitRule
+	// Store 限流状态的存储, 为空时使用 NewMemoryStore(0, 0)
+	Store Store
+	// KeyFunc 区分限流对象, 为空时使用 KeyByIP, 返回空字符串时不限流。
+	// 服务部署在反向代理之后时使用 KeyByIPWithProxies
+	KeyFunc func(c *Context) string
+	// Skip 返回 true 时跳过限流
+	Skip func(c *Context) bool
+	// Handler 自定义被限流时的响应, 为空时返回 429
+	Handler func(c *Context, res RateLimitResult)
+}
+
+// RateLimit 按客户端 IP 使用令牌桶限流, 每个 window 最多 limit 个请求
+func RateLimit(limit int, window time.Duration) HandlerFunc {
+	return RateLimitWithConfig(RateLimitConfig{
+		RateLimitRule: RateLimitRule{Algorithm: TokenBucket, Limit: limit, Window: window},
+	})
+}
+
+// RateLimitWithConfig 根据配置创建限流中间件。
+// 响应中会带有 X-RateLimit-Limit, X-RateLimit-Remaining 和 X-RateLimit-Reset(秒),
+// 被限流时额外带有 Retry-After 并返回 429; Store 出错时记录日志并放行请求
+func RateLimitWithConfig(conf RateLimitConfig) HandlerFunc {
+	if conf.Limit <= 0 || conf.Window <= 0 {
+		panic("[GEE] rate limit and window must be positive")
+	}
+	if conf.Store == nil {
+		conf.Store = NewMemoryStore(0, 0)
+	}
+	if conf.KeyFunc == nil {
+		conf.KeyFunc = KeyByIP()
+	}
+	return func(c *Context) {
+		if conf.Skip != nil && conf.Skip(c) {
+			c.Next()
+			return
+		}
+		key := conf.KeyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+		res, err := conf.Store.Take(key, conf.RateLimitRule, time.Now())
+		if err != nil {
+			c.log().Error("rate limit store failed", "key", key, "err", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		if res.Allowed {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+		if conf.Handler != nil {
+			conf.Handler(c, res)
+			c.Abort()
+			return
+		}
+		c.AbortWithJson(http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+	}
+}
+
+// KeyByIP 按连接的对端地址限流。X-Forwarded-For 可以由客户端任意伪造, 因此不会使用
+func KeyByIP() func(c *Context) string {
+	return func(c *Context) string {
+		return "ip:" + remoteHost(c.Req)
+	}
+}
+
+// KeyByIPWithProxies 按客户端 IP 限流, trusted 为可信的反向代理地址, 可以是 IP 或者 CIDR。
+// 只有对端地址属于可信代理时才使用 X-Forwarded-For, 从右向左跳过可信代理, 取第一个不可信的地址,
+// 客户端伪造的部分位于左侧, 不会被使用。trusted 中有无法解析的地址时 panic
+func KeyByIPWithProxies(trusted ...string) func(c *Context) string {
+	nets := make([]*net.IPNet, 0, len(trusted))
+	for _, t := range trusted {
+		if !strings.Contains(t, "/") {
+			if ip := net.ParseIP(t); ip != nil && ip.To4() != nil {
+				t += "/32"
+			} else {
+				t += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(t)
+		if err != nil {
+			panic("[GEE] invalid trusted proxy: " + err.Error())
+		}
+		nets = append(nets, n)
+	}
+	isTrusted := func(ip net.IP) bool {
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *Context) string {
+		host := remoteHost(c.Req)
+		ip := net.ParseIP(host)
+		if ip == nil || !isTrusted(ip) {
+			return "ip:" + host
+		}
+		hops := strings.Split(strings.Join(c.Req.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				// 无法解析的地址之前的内容不可信, 使用最后一个可信代理
+				break
+			}
+			host = hop.String()
+			if !isTrusted(hop) {
+				break
+			}
+		}
+		return "ip:" + host
+	}
+}
+
+// remoteHost 返回连接对端的地址, 不包含端口
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader 按请求头的值限流, 比如 API Key, 请求头为空时不限流
+func KeyByHeader(name string) func(c *Context) string {
+	return func(c *Context) string {
+		if v := c.GetHeader(name); v != "" {
+			return "header:" + name + ":" + v
+		}
+		return ""
+	}
+}
+
+// KeyByRoute 按路由限流, 同一个路由的所有请求共享额度
+func KeyByRoute() func(c *Context) string {
+	return func(c *Context) string {
+		route := c.FullPath()
+		if route == "" {
+			route = c.Path
+		}
+		return "route:" + c.Method + " " + route
+	}
+}
+
+// ceilSeconds 向上取整为秒, 用于响应头
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+const (
+	defaultStoreShards     = 32
+	defaultStoreMaxEntries = 10000
+	storeSweepInterval     = time.Minute
+)
+
+// MemoryStore 进程内的限流存储, 按 key 分片加锁以减少竞争。
+// 每个分片定期清理已经恢复满额度的 key, 不需要后台协程; 每个分片的 key 数量有上限,
+// 达到上限时先清理过期的 key, 仍然没有空间时淘汰最早过期的 key, 被淘汰的 key 额度重新计算
+type MemoryStore struct {
+	shards []*storeShard
+}
+
+var _ Store = &MemoryStore{}
+
+type storeShard struct {
+	mu         sync.Mutex
+	entries    map[string]*limitEntry
+	maxEntries int
+	nextSweep  time.Time
+}
+
+// limitEntry 令牌桶使用 tokens 和 last, 滑动窗口使用 start, prev 和 curr
+type limitEntry struct {
+	tokens   float64
+	last     time.Time
+	start    time.Time
+	prev     int
+	curr     int
+	expireAt time.Time // 在此之后状态与新建时相同, 可以清理
+}
+
+// NewMemoryStore 创建分片数量为 shards, 每个分片最多保存 maxEntries 个 key 的内存存储,
+// shards <= 0 时使用 32, maxEntries <= 0 时使用 10000
+func NewMemoryStore(shards, maxEntries int) *MemoryStore {
+	if shards <= 0 {
+		shards = defaultStoreShards
+	}
+	if maxEntries <= 0 {
+		maxEntries = defaultStoreMaxEntries
+	}
+	s := &MemoryStore{shards: make([]*storeShard, shards)}
+	for i := range s.shards {
+		s.shards[i] = &storeShard{entries: make(map[string]*limitEntry), maxEntries: maxEntries}
+	}
+	return s
+}
+
+// Len 返回当前保存的 key 数量
+func (s *MemoryStore) Len() (n int) {
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		n += len(shard.entries)
+		shard.mu.Unlock()
+	}
+	return
+}
+
+// Take 消耗 key 的一次额度
+func (s *MemoryStore) Take(key string, rule RateLimitRule, now time.Time) (RateLimitResult, error) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	shard := s.shards[h.Sum32()%uint32(len(s.shards))]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if now.After(shard.nextSweep) {
+		shard.sweep(now)
+	}
+	e, ok := shard.entries[key]
+	if !ok {
+		if len(shard.entries) >= shard.maxEntries {
+			shard.evict(now)
+		}
+		e = &limitEntry{tokens: float64(rule.Limit), last: now, start: now}
+		shard.entries[key] = e
+	}
+	if rule.Algorithm == SlidingWindow {
+		return e.slidingWindow(rule, now), nil
+	}
+	return e.tokenBucket(rule, now), nil
+}
+
+// sweep 删除已经过期的 key
+func (s *storeShard) sweep(now time.Time) {
+	for k, e := range s.entries {
+		if !now.Before(e.expireAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.nextSweep = now.Add(storeSweepInterval)
+}
+
+// evict 分片已满时腾出空间, 没有过期的 key 时淘汰最早过期的 key
+func (s *storeShard) evict(now time.Time) {
+	s.sweep(now)
+	if len(s.entries) < s.maxEntries {
+		return
+	}
+	var oldest string
+	var oldestAt time.Time
+	for k, e := range s.entries {
+		if oldestAt.IsZero() || e.expireAt.Before(oldestAt) {
+			oldest, oldestAt = k, e.expireAt
+		}
+	}
+	delete(s.entries, oldest)
+}
+
+func (e *limitEntry) tokenBucket(rule RateLimitRule, now time.Time) RateLimitResult {
+	limit := float64(rule.Limit)
+	rate := limit / rule.Window.Seconds() // 每秒补充的令牌数
+	if elapsed := now.Sub(e.last).Seconds(); elapsed > 0 {
+		e.tokens = math.Min(limit, e.tokens+elapsed*rate)
+		e.last = now
+	}
+
+	res := RateLimitResult{Limit: rule.Limit}
+	if e.tokens >= 1 {
+		e.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - e.tokens) / rate)
+	}
+	res.Remaining = int(e.tokens)
+	res.Reset = secondsToDuration((limit - e.tokens) / rate)
+	e.expireAt = now.Add(res.Reset)
+	return res
+}
+
+func (e *limitEntry) slidingWindow(rule RateLimitRule, now time.Time) RateLimitResult {
+	// 将窗口推进到 now 所在的窗口
+	if passed := now.Sub(e.start); passed >= rule.Window {
+		n := passed / rule.Window
+		if n == 1 {
+			e.prev = e.curr
+		} else {
+			e.prev = 0
+		}
+		e.curr = 0
+		e.start = e.start.Add(n * rule.Window)
+	}
+
+	elapsed := now.Sub(e.start)
+	weight := 1 - float64(elapsed)/float64(rule.Window)
+	count := float64(e.prev)*weight + float64(e.curr)
+
+	res := RateLimitResult{Limit: rule.Limit}
+	if count+1 <= float64(rule.Limit) {
+		e.curr++
+		count++
+		res.Allowed = true
+	} else if e.curr+1 > rule.Limit || e.prev == 0 {
+		// 只能等到下一个窗口
+		res.RetryAfter = rule.Window - elapsed
+	} else {
+		// 等待上一个窗口的权重下降到足够放行一个请求
+		need := 1 - float64(rule.Limit-e.curr-1)/float64(e.prev)
+		res.RetryAfter = time.Duration(need*float64(rule.Window)) - elapsed
+	}
+	res.Remaining = rule.Limit - int(math.Ceil(count))
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	res.Reset = 2*rule.Window - elapsed
+	if e.curr == 0 {
+		res.Reset = rule.Window - elapsed
+	}
+	e.expireAt = now.Add(res.Reset)
+	return res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
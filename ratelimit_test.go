@@ -0,0 +1,162 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	s := NewMemoryStore(1, 0)
+	rule := RateLimitRule{Algorithm: TokenBucket, Limit: 3, Window: 3 * time.Second}
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		if res, _ := s.Take("k", rule, now); !res.Allowed || res.Remaining != i {
+			t.Fatalf("burst request should be allowed with remaining %d: %+v", i, res)
+		}
+	}
+	res, _ := s.Take("k", rule, now)
+	if res.Allowed || res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Fatalf("empty bucket should be rejected: %+v", res)
+	}
+	if res, _ = s.Take("k", rule, now.Add(time.Second)); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("one token should be refilled after a second: %+v", res)
+	}
+	if res, _ = s.Take("other", rule, now); !res.Allowed {
+		t.Fatalf("keys should be limited separately: %+v", res)
+	}
+
+	// 额度恢复满之后的 key 在下一次清理时被删除
+	s.Take("k", rule, now.Add(storeSweepInterval+time.Second))
+	if s.Len() != 1 {
+		t.Fatalf("expired keys should be evicted, len = %d", s.Len())
+	}
+}
+
+func TestMemoryStoreMaxEntries(t *testing.T) {
+	s := NewMemoryStore(1, 2)
+	rule := RateLimitRule{Algorithm: TokenBucket, Limit: 2, Window: time.Minute}
+	now := time.Now()
+
+	s.Take("a", rule, now)
+	s.Take("b", rule, now.Add(time.Second))
+	s.Take("a", rule, now.Add(2*time.Second))
+	// 分片已满时淘汰最早过期的 b, 而不是无限增长
+	s.Take("c", rule, now.Add(3*time.Second))
+	if s.Len() != 2 {
+		t.Fatalf("store should be capped at 2 keys, len = %d", s.Len())
+	}
+	if res, _ := s.Take("a", rule, now.Add(3*time.Second)); res.Allowed {
+		t.Fatalf("a should keep its state after eviction: %+v", res)
+	}
+}
+
+func TestMemoryStoreSlidingWindow(t *testing.T) {
+	s := NewMemoryStore(1, 0)
+	rule := RateLimitRule{Algorithm: SlidingWindow, Limit: 4, Window: 10 * time.Second}
+	now := time.Now()
+
+	for i := 0; i < 4; i++ {
+		if res, _ := s.Take("k", rule, now); !res.Allowed {
+			t.Fatalf("request %d should be allowed: %+v", i, res)
+		}
+	}
+	res, _ := s.Take("k", rule, now.Add(5*time.Second))
+	if res.Allowed || res.RetryAfter != 5*time.Second {
+		t.Fatalf("full window should be rejected until it ends: %+v", res)
+	}
+	// 进入下一个窗口 5 秒后, 上一个窗口的权重为 0.5, 还可以放行 2 个请求
+	next := now.Add(15 * time.Second)
+	for i := 0; i < 2; i++ {
+		if res, _ = s.Take("k", rule, next); !res.Allowed {
+			t.Fatalf("weighted request %d should be allowed: %+v", i, res)
+		}
+	}
+	res, _ = s.Take("k", rule, next)
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != 2500*time.Millisecond {
+		t.Fatalf("weighted window should be rejected: %+v", res)
+	}
+	if res, _ = s.Take("k", rule, now.Add(30*time.Second)); !res.Allowed || res.Remaining != 3 {
+		t.Fatalf("window should be reset after two windows: %+v", res)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	r := Default(WithReleaseMode(true), WithMiddlewares(RateLimitWithConfig(RateLimitConfig{
+		RateLimitRule: RateLimitRule{Limit: 2, Window: time.Minute},
+		KeyFunc:       KeyByHeader("X-Api-Key"),
+	})))
+	r.GET("/ping", func(c *Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	do := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		if key != "" {
+			req.Header.Set("X-Api-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := do("a"); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Fatalf("request %d should pass, status = %d, header = %v", i, w.Code, w.Header())
+		}
+	}
+	w := do("a")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" ||
+		w.Header().Get("X-RateLimit-Remaining") != "0" || w.Header().Get("X-RateLimit-Reset") != "60" {
+		t.Fatalf("third request should be limited, status = %d, header = %v", w.Code, w.Header())
+	}
+	if w = do("b"); w.Code != http.StatusOK {
+		t.Fatalf("another key should pass, status = %d", w.Code)
+	}
+	if w = do(""); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+		t.Fatalf("request without key should not be limited, header = %v", w.Header())
+	}
+}
+
+func TestRateLimitKeyFuncs(t *testing.T) {
+	r := Default(WithReleaseMode(true), WithMiddlewares(Recover()))
+	var ip, proxied, route string
+	byProxy := KeyByIPWithProxies("10.0.0.0/8", "192.168.1.1")
+	r.GET("/p/:id", func(c *Context) {
+		ip, proxied, route = KeyByIP()(c), byProxy(c), KeyByRoute()(c)
+	})
+
+	tests := []struct {
+		remote, xff string
+		ip, proxied string
+	}{
+		{"203.0.113.9:52311", "", "ip:203.0.113.9", "ip:203.0.113.9"},
+		// 客户端直接连接时伪造的 X-Forwarded-For 不能绕过限流
+		{"203.0.113.9:52311", "1.2.3.4", "ip:203.0.113.9", "ip:203.0.113.9"},
+		{"10.0.0.1:52311", "1.2.3.4", "ip:10.0.0.1", "ip:1.2.3.4"},
+		// 客户端在经过代理之前伪造的地址位于左侧
+		{"10.0.0.1:52311", "6.6.6.6, 1.2.3.4, 192.168.1.1", "ip:10.0.0.1", "ip:1.2.3.4"},
+		{"10.0.0.1:52311", "garbage, 10.0.0.2", "ip:10.0.0.1", "ip:10.0.0.2"},
+		{"[2001:db8::1]:443", "1.2.3.4", "ip:2001:db8::1", "ip:2001:db8::1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/p/1", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if ip != tt.ip || proxied != tt.proxied || route != "route:GET /p/:id" {
+			t.Errorf("remote %s, xff %q: ip = %q, proxied = %q, route = %q", tt.remote, tt.xff, ip, proxied, route)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("invalid trusted proxy should panic")
+		}
+	}()
+	KeyByIPWithProxies("not an ip")
+}
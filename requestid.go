@@ -0,0 +1,101 @@
+package gee
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// RequestIDHeader 默认传递请求 ID 的请求头和响应头
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey 请求 ID 保存在 Context.Keys 中的键
+	RequestIDKey = "gee.requestID"
+
+	maxRequestIDLen = 128
+)
+
+// requestIDCtxKey 请求 ID 保存在 http.Request 上下文中的键
+type requestIDCtxKey struct{}
+
+// RequestIDConfig 请求 ID 中间件的配置
+type RequestIDConfig struct {
+	// Header 读取和写回请求 ID 的头部, 为空时使用 X-Request-ID
+	Header string
+	// Generator 生成新的请求 ID, 为空时生成 32 位十六进制随机字符串
+	Generator func() string
+	// Validator 校验请求中携带的 ID, 不通过时重新生成, 为空时使用 validRequestID
+	Validator func(id string) bool
+}
+
+// RequestID 请求 ID 中间件, 使用默认配置
+func RequestID() HandlerFunc {
+	return RequestIDWithConfig(RequestIDConfig{})
+}
+
+// RequestIDWithConfig 根据配置创建请求 ID 中间件。
+// 请求中携带合法的 ID 时继续使用, 否则生成新的 ID; ID 会保存在 Context.Keys 和请求的上下文中,
+// 并通过响应头写回, Logger 和 Recover 会自动输出该 ID
+func RequestIDWithConfig(conf RequestIDConfig) HandlerFunc {
+	if conf.Header == "" {
+		conf.Header = RequestIDHeader
+	}
+	if conf.Generator == nil {
+		conf.Generator = newRequestID
+	}
+	if conf.Validator == nil {
+		conf.Validator = validRequestID
+	}
+	return func(c *Context) {
+		id := c.GetHeader(conf.Header)
+		if !conf.Validator(id) {
+			id = conf.Generator()
+		}
+		c.Set(RequestIDKey, id)
+		c.Req = c.Req.WithContext(context.WithValue(c.Req.Context(), requestIDCtxKey{}, id))
+		c.Header(conf.Header, id)
+		c.Next()
+	}
+}
+
+// RequestID 返回 RequestID 中间件设置的请求 ID, 没有使用该中间件时返回空字符串
+func (c *Context) RequestID() string {
+	return c.GetString(RequestIDKey)
+}
+
+// RequestIDFromContext 从 context.Context 中获取请求 ID, 用于将 ID 传递给下游服务或者其他组件
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// validRequestID 只接受长度不超过 128 的字母, 数字以及 - _ . : 组成的 ID, 防止日志注入
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		ch := id[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case ch == '-', ch == '_', ch == '.', ch == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+var requestIDSeq uint64
+
+// newRequestID 生成 32 位十六进制随机字符串, 随机数不可用时退化为时间戳加序号
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(atomic.AddUint64(&requestIDSeq, 1), 36)
+	}
+	return hex.EncodeToString(b[:])
+}
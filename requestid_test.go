@@ -0,0 +1,72 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	r := Default(WithReleaseMode(true), WithMiddlewares(
+		RequestID(),
+		LoggerWithConfig(LoggerConfig{Output: &buf, Formatter: JSONLogFormatter}),
+	))
+	r.GET("/id", func(c *Context) {
+		c.String(http.StatusOK, "%s|%s", c.RequestID(), RequestIDFromContext(c.Req.Context()))
+	})
+
+	tests := []struct {
+		incoming string
+		reuse    bool
+	}{
+		{"", false},
+		{"trace-42.a:b_c", true},
+		{"bad id\nwith newline", false},
+		{strings.Repeat("a", maxRequestIDLen+1), false},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/id", nil)
+		if tt.incoming != "" {
+			req.Header.Set(RequestIDHeader, tt.incoming)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		id := w.Header().Get(RequestIDHeader)
+		if tt.reuse && id != tt.incoming || !tt.reuse && (id == tt.incoming || len(id) != 32) {
+			t.Errorf("incoming %q, response id = %q", tt.incoming, id)
+		}
+		if w.Body.String() != id+"|"+id {
+			t.Errorf("keys and request context should hold %q, body = %q", id, w.Body.String())
+		}
+		var entry map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil || entry["request_id"] != id {
+			t.Errorf("logger should output request id %q: %q", id, buf.String())
+		}
+	}
+}
+
+func TestRequestIDRecovery(t *testing.T) {
+	var buf bytes.Buffer
+	r := Default(WithReleaseMode(true), WithMiddlewares(
+		RequestIDWithConfig(RequestIDConfig{Header: "X-Trace-ID", Generator: func() string { return "generated" }}),
+		RecoveryWithConfig(RecoveryConfig{Output: &buf}),
+	))
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if w.Header().Get("X-Trace-ID") != "generated" {
+		t.Fatalf("response should carry generated id, header = %v", w.Header())
+	}
+	if !strings.HasPrefix(buf.String(), "[Recovery] request_id=generated ") {
+		t.Fatalf("recovery output should contain request id: %q", buf.String())
+	}
+}
@@ -0,0 +1,67 @@
+package gee
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// responseWriter 包装 http.ResponseWriter, 记录写回的状态码和响应体大小。
+// 同时透传 Flush 和 Hijack, 保证流式响应和 WebSocket 可以正常使用
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+var (
+	_ http.Flusher  = &responseWriter{}
+	_ http.Hijacker = &responseWriter{}
+)
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(data []byte) (n int, err error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err = w.ResponseWriter.Write(data)
+	w.size += n
+	return
+}
+
+// Written 是否已经写回了响应头
+func (w *responseWriter) Written() bool {
+	return w.status != 0
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, ErrNotHijacker
+	}
+	return h.Hijack()
+}
+
+// Unwrap 返回原始的 http.ResponseWriter, 供 http.ResponseController 使用
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,122 @@
+package gee
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// listenFdsEnv 平滑重启时告诉新进程继承了多少个 listener, 它们的文件描述符从 listenFdsStart 开始依次排列
+const listenFdsEnv = "GEE_LISTEN_FDS"
+
+// readyFdEnv 平滑重启时告诉新进程用于通知父进程已经就绪的管道描述符
+const readyFdEnv = "GEE_READY_FD"
+
+// listenFdsStart exec.Cmd.ExtraFiles 中的第一个文件在子进程中的描述符为 3
+var listenFdsStart = 3
+
+// readyOnce 保证只通知父进程一次
+var readyOnce sync.Once
+
+// inherited 保存从父进程继承的 listener, 按照父进程中创建的顺序依次被 listen 取出
+var inherited struct {
+	once      sync.Once
+	mu        sync.Mutex
+	listeners []net.Listener
+	err       error
+}
+
+// takeInherited 取出下一个从父进程继承的 listener, 没有时返回 nil
+func takeInherited() (net.Listener, error) {
+	inherited.once.Do(func() {
+		count, _ := strconv.Atoi(os.Getenv(listenFdsEnv))
+		_ = os.Unsetenv(listenFdsEnv)
+		for i := 0; i < count; i++ {
+			fd := listenFdsStart + i
+			f := os.NewFile(uintptr(fd), fmt.Sprintf("listener@%d", fd))
+			l, err := net.FileListener(f)
+			_ = f.Close()
+			if err != nil {
+				inherited.err = fmt.Errorf("[GEE] inherit listener fd %d: %w", fd, err)
+				return
+			}
+			inherited.listeners = append(inherited.listeners, l)
+		}
+	})
+
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	if inherited.err != nil || len(inherited.listeners) == 0 {
+		return nil, inherited.err
+	}
+	l := inherited.listeners[0]
+	inherited.listeners = inherited.listeners[1:]
+	return l, nil
+}
+
+// listen 开启平滑重启时优先使用从父进程继承的 listener, 否则创建新的 listener
+func (engine *Engine) listen(network, addr string) (net.Listener, error) {
+	if engine.gracefulRestart {
+		if l, err := takeInherited(); l != nil || err != nil {
+			return l, err
+		}
+	}
+	if network == "unix" {
+		// 删除上次运行遗留的 socket 文件
+		_ = os.Remove(addr)
+	}
+	return net.Listen(network, addr)
+}
+
+// filer 可以导出底层文件描述符的 listener, 比如 *net.TCPListener 和 *net.UnixListener
+type filer interface {
+	File() (*os.File, error)
+}
+
+// listenerFiles 导出所有正在运行的 listener 的文件描述符, 用于交给新进程
+func (engine *Engine) listenerFiles() (files []*os.File, err error) {
+	engine.srvMu.Lock()
+	defer engine.srvMu.Unlock()
+	for _, l := range engine.listeners {
+		fl, ok := l.(filer)
+		if !ok {
+			err = fmt.Errorf("[GEE] listener %s can not be passed to new process", l.Addr())
+			break
+		}
+		var f *os.File
+		if f, err = fl.File(); err != nil {
+			break
+		}
+		files = append(files, f)
+	}
+	if err != nil {
+		for _, f := range files {
+			_ = f.Close()
+		}
+		return nil, err
+	}
+	// 新进程接管之后, 当前进程关闭 listener 时不能删除 socket 文件
+	for _, l := range engine.listeners {
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	return
+}
+
+// notifyReady 新进程开始提供服务之后通知父进程, 父进程收到通知之后才会关闭自己的服务。
+// 不是由平滑重启启动的进程不做任何事
+func notifyReady() {
+	readyOnce.Do(func() {
+		fd, err := strconv.Atoi(os.Getenv(readyFdEnv))
+		_ = os.Unsetenv(readyFdEnv)
+		if err != nil {
+			return
+		}
+		f := os.NewFile(uintptr(fd), "ready")
+		_, _ = f.Write([]byte{1})
+		_ = f.Close()
+	})
+}
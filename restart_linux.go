@@ -0,0 +1,101 @@
+package gee
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// restartSignals 触发平滑重启的信号
+var restartSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR2}
+
+// restartReadyTimeout 等待新进程就绪的最长时间, 超时之后结束新进程并继续使用当前进程提供服务
+var restartReadyTimeout = 30 * time.Second
+
+// restartCommand 返回新进程的可执行文件和参数, 默认使用当前程序和相同的参数
+var restartCommand = func() (path string, args []string, err error) {
+	path, err = os.Executable()
+	return path, os.Args[1:], err
+}
+
+// restart 启动当前程序的新进程, 将所有 listener 的文件描述符交给它, 并等待它开始提供服务。
+// 新进程启动失败, 提前退出或者超时没有就绪时返回错误, 当前进程不应该关闭
+func (engine *Engine) restart() error {
+	files, err := engine.listenerFiles()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	path, args, err := restartCommand()
+	if err != nil {
+		return err
+	}
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, listenFdsEnv+"=") && !strings.HasPrefix(kv, readyFdEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env,
+		fmt.Sprintf("%s=%d", listenFdsEnv, len(files)),
+		fmt.Sprintf("%s=%d", readyFdEnv, listenFdsStart+len(files)))
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = env
+	cmd.ExtraFiles = append(files, readyW)
+	err = cmd.Start()
+	// 只保留新进程中的写端, 新进程退出时读端才能收到 EOF
+	_ = readyW.Close()
+	// 传递文件时 os/exec 调用 Fd 将共享的文件描述符设置为阻塞模式,
+	// 需要恢复为非阻塞模式, 否则当前进程的 Accept 会阻塞在系统调用中, 关闭 listener 时无法返回
+	for _, f := range files {
+		_ = syscall.SetNonblock(int(f.Fd()), true)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = waitReady(ready, restartReadyTimeout); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("[GEE] new process %d is not ready: %w", cmd.Process.Pid, err)
+	}
+	// 回收新进程, 避免当前进程关闭期间新进程退出后成为僵尸进程
+	go func() { _ = cmd.Wait() }()
+	engine.logger.Info("restart new process", "pid", cmd.Process.Pid)
+	return nil
+}
+
+// waitReady 等待新进程通过管道发送就绪通知
+func waitReady(ready *os.File, timeout time.Duration) error {
+	if err := ready.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	var buf [1]byte
+	n, err := ready.Read(buf[:])
+	switch {
+	case n == 1:
+		return nil
+	case err == io.EOF:
+		return errors.New("process exited before ready")
+	default:
+		return err
+	}
+}
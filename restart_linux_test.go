@@ -0,0 +1,238 @@
+package gee
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// resetInherited 清空从父进程继承的状态, 使下一次 takeInherited 重新读取环境变量
+func resetInherited() {
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	for _, l := range inherited.listeners {
+		_ = l.Close()
+	}
+	inherited.once = sync.Once{}
+	inherited.listeners, inherited.err = nil, nil
+}
+
+func TestListenInheritedListener(t *testing.T) {
+	resetInherited()
+	t.Cleanup(resetInherited)
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+
+	r := New()
+	r.listeners = []net.Listener{parent}
+	files, err := r.listenerFiles()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("listenerFiles() = %v, %v", files, err)
+	}
+	defer files[0].Close()
+	// 继承时会关闭对应的描述符, 这里复制一份交给它
+	fd, err := syscall.Dup(int(files[0].Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟新进程: 从环境变量中得到继承的 listener 数量和起始描述符
+	oldStart := listenFdsStart
+	listenFdsStart = fd
+	defer func() { listenFdsStart = oldStart }()
+	t.Setenv(listenFdsEnv, strconv.Itoa(len(files)))
+
+	child := Default(WithGracefulRestart(true))
+	l, err := child.listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l.Addr().String() != parent.Addr().String() {
+		t.Fatalf("inherited listener addr = %s, want %s", l.Addr(), parent.Addr())
+	}
+	if os.Getenv(listenFdsEnv) != "" {
+		t.Fatal("inherited env should be cleared after use")
+	}
+
+	// 继承的 listener 用完之后重新创建
+	l2, err := child.listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	if l2.Addr().String() == parent.Addr().String() {
+		t.Fatal("listen should create new listener when no inherited listener left")
+	}
+}
+
+// restartChildEnv 控制 TestGracefulRestartChild 作为新进程时的行为
+const restartChildEnv = "GEE_TEST_RESTART_CHILD"
+
+func pidHandler(c *Context) {
+	c.String(http.StatusOK, "%d", os.Getpid())
+}
+
+// TestGracefulRestartChild 只在平滑重启测试中作为新进程运行
+func TestGracefulRestartChild(t *testing.T) {
+	switch os.Getenv(restartChildEnv) {
+	case "":
+		t.Skip("only runs as the restarted process")
+	case "fail":
+		os.Exit(1)
+	case "hang":
+		time.Sleep(time.Minute)
+		os.Exit(1)
+	}
+	r := Default(WithReleaseMode(true), WithGracefulRestart(true), WithExitOp(true), WithMiddlewares(Recover()))
+	r.GET("/pid", pidHandler)
+	if err := r.Run("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// restartWithTestBinary 平滑重启时使用当前测试程序运行 TestGracefulRestartChild
+func restartWithTestBinary(t *testing.T, mode string) {
+	t.Setenv(restartChildEnv, mode)
+	old := restartCommand
+	restartCommand = func() (string, []string, error) {
+		path, err := os.Executable()
+		return path, []string{"-test.run=^TestGracefulRestartChild$"}, err
+	}
+	t.Cleanup(func() { restartCommand = old })
+}
+
+// servedPid 使用新的连接请求 /pid, 返回处理请求的进程
+func servedPid(addr string) int {
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: time.Second}
+	resp, err := client.Get(addr + "/pid")
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	pid, _ := strconv.Atoi(string(body))
+	return pid
+}
+
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestGracefulRestart(t *testing.T) {
+	restartWithTestBinary(t, "serve")
+	// 保证测试进程收到 SIGHUP 时不会退出
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	r := Default(WithReleaseMode(true), WithGracefulRestart(true), WithMiddlewares(Recover()))
+	r.GET("/pid", pidHandler)
+	r.GET("/slow", func(c *Context) {
+		close(started)
+		<-release
+		c.String(http.StatusOK, "drained")
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "http://" + l.Addr().String()
+	done := make(chan error, 1)
+	go func() { done <- r.RunListener(l) }()
+	waitUntil(t, "parent serving", func() bool { return servedPid(addr) == os.Getpid() })
+
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(addr + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		slow <- string(body)
+	}()
+	<-started
+
+	if err = syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	var child int
+	waitUntil(t, "new process serving", func() bool {
+		child = servedPid(addr)
+		return child != 0 && child != os.Getpid()
+	})
+	defer func() {
+		_ = syscall.Kill(child, syscall.SIGTERM)
+		waitUntil(t, "new process exit", func() bool { return servedPid(addr) == 0 })
+	}()
+
+	// 旧进程等待正在处理的请求结束之后才退出
+	select {
+	case err = <-done:
+		t.Fatalf("parent returned before draining in-flight request: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if body := <-slow; body != "drained" {
+		t.Fatalf("in-flight request should be drained, got %q", body)
+	}
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatalf("parent should exit cleanly, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("parent did not exit after draining")
+	}
+	for i := 0; i < 3; i++ {
+		if pid := servedPid(addr); pid != child {
+			t.Fatalf("requests after restart should be served by %d, got %d", child, pid)
+		}
+	}
+}
+
+func TestGracefulRestartNotReady(t *testing.T) {
+	old := restartReadyTimeout
+	restartReadyTimeout = 500 * time.Millisecond
+	defer func() { restartReadyTimeout = old }()
+
+	for _, mode := range []string{"fail", "hang"} {
+		restartWithTestBinary(t, mode)
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := New()
+		r.listeners = []net.Listener{l}
+		if err = r.restart(); err == nil {
+			t.Errorf("%s: restart should fail when the new process is not ready", mode)
+		}
+		// 当前进程的 listener 不受影响
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Errorf("%s: listener should still accept connections: %v", mode, err)
+		} else {
+			_ = conn.Close()
+		}
+		_ = l.Close()
+	}
+}
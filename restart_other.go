@@ -0,0 +1,17 @@
+//go:build !linux
+
+package gee
+
+import (
+	"errors"
+	"os"
+)
+
+var errRestartUnsupported = errors.New("[GEE] graceful restart is not supported on this platform")
+
+// restartSignals 非 Linux 平台不支持平滑重启
+var restartSignals []os.Signal
+
+func (engine *Engine) restart() error {
+	return errRestartUnsupported
+}
@@ -0,0 +1,308 @@
+package gee
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateConfig 日志文件切分的配置
+type RotateConfig struct {
+	Filename   string        // 日志文件路径, 旧文件保存在同一目录下
+	MaxSize    int64         // 单个文件的最大字节数, <= 0 时不按大小切分
+	MaxAge     time.Duration // 单个文件的最长使用时间, <= 0 时不按时间切分
+	MaxBackups int           // 最多保留的旧文件数量, <= 0 时全部保留
+	Compress   bool          // 是否使用 gzip 压缩旧文件
+}
+
+// RotateWriter 按照大小和时间自动切分的日志文件, 可以作为 LoggerConfig.Output 使用, 并发写入是安全的。
+// 旧文件以 name-时间.ext 的形式保存, 压缩和清理在后台进行
+type RotateWriter struct {
+	conf RotateConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	millMu sync.Mutex     // 保证同一时间只有一个压缩和清理任务
+	wg     sync.WaitGroup // 等待后台任务结束
+
+	now func() time.Time
+}
+
+var _ io.WriteCloser = &RotateWriter{}
+
+// NewRotateWriter 打开 conf.Filename 并返回 RotateWriter, 已经存在的文件会继续追加写入
+func NewRotateWriter(conf RotateConfig) (*RotateWriter, error) {
+	if conf.Filename == "" {
+		return nil, errors.New("[GEE] rotate writer filename is empty")
+	}
+	w := &RotateWriter{conf: conf, now: time.Now}
+	if err := w.openFile(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write 写入日志, 写入之前检查是否需要切分
+func (w *RotateWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err = w.openFile(); err != nil {
+			return
+		}
+	}
+	if w.shouldRotate(int64(len(p))) {
+		if err = w.rotate(); err != nil {
+			return
+		}
+	}
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+	return
+}
+
+// Rotate 立即切分当前文件
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// Reopen 关闭并重新打开日志文件, 用于配合 logrotate 等外部工具移动文件之后使用
+func (w *RotateWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+	return w.openFile()
+}
+
+// ReopenOnSignal 收到信号时调用 Reopen, 没有指定信号时使用 SIGUSR1 (仅类 Unix 系统)。
+// 返回的函数用于停止监听
+func (w *RotateWriter) ReopenOnSignal(signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = reopenSignals
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	if len(signals) > 0 {
+		signal.Notify(ch, signals...)
+	}
+	go func() {
+		for {
+			select {
+			case <-ch:
+				_ = w.Reopen()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// Close 关闭日志文件, 并等待后台的压缩和清理任务结束
+func (w *RotateWriter) Close() (err error) {
+	w.mu.Lock()
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+	return
+}
+
+func (w *RotateWriter) shouldRotate(n int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.conf.MaxSize > 0 && w.size+n > w.conf.MaxSize {
+		return true
+	}
+	return w.conf.MaxAge > 0 && w.now().Sub(w.openedAt) >= w.conf.MaxAge
+}
+
+func (w *RotateWriter) openFile() error {
+	if err := os.MkdirAll(filepath.Dir(w.conf.Filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.conf.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	w.openedAt = w.now()
+	return nil
+}
+
+// rotate 将当前文件重命名为旧文件并打开新的文件, 调用方需要持有 mu
+func (w *RotateWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	if err := os.Rename(w.conf.Filename, w.backupName()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.openFile(); err != nil {
+		return err
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.mill()
+	}()
+	return nil
+}
+
+// backupName 根据当前时间生成旧文件名, 同名时追加序号
+func (w *RotateWriter) backupName() string {
+	dir, prefix, ext := w.nameParts()
+	base := filepath.Join(dir, prefix+w.now().Format(backupTimeFormat))
+	name := base + ext
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%d%s", base, i, ext)
+	}
+	return name
+}
+
+// nameParts 将 /var/log/access.log 拆分为 /var/log, access-, .log
+func (w *RotateWriter) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(w.conf.Filename)
+	base := filepath.Base(w.conf.Filename)
+	ext = filepath.Ext(base)
+	prefix = strings.TrimSuffix(base, ext) + "-"
+	return
+}
+
+// mill 压缩旧文件并删除超出 MaxBackups 数量的旧文件
+func (w *RotateWriter) mill() {
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+
+	backups, err := w.backups()
+	if err != nil {
+		return
+	}
+	if w.conf.Compress {
+		for i, name := range backups {
+			if strings.HasSuffix(name, ".gz") {
+				continue
+			}
+			if err = compressFile(name); err == nil {
+				backups[i] = name + ".gz"
+			}
+		}
+	}
+	if w.conf.MaxBackups > 0 && len(backups) > w.conf.MaxBackups {
+		for _, name := range backups[w.conf.MaxBackups:] {
+			_ = os.Remove(name)
+		}
+	}
+}
+
+// backups 返回所有旧文件, 按照时间从新到旧排列
+func (w *RotateWriter) backups() ([]string, error) {
+	dir, prefix, ext := w.nameParts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type backup struct {
+		name string
+		t    time.Time
+	}
+	list := make([]backup, 0)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)[len(prefix):]
+		if len(ts) < len(backupTimeFormat) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, ts[:len(backupTimeFormat)])
+		if err != nil {
+			continue
+		}
+		list = append(list, backup{name: filepath.Join(dir, name), t: t})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].t.Equal(list[j].t) {
+			return list[i].name > list[j].name
+		}
+		return list[i].t.After(list[j].t)
+	})
+
+	names := make([]string, len(list))
+	for i, b := range list {
+		names[i] = b.name
+	}
+	return names, nil
+}
+
+// compressFile 将 name 压缩为 name.gz 并删除原文件
+func compressFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(name + ".gz")
+		return
+	}
+	return os.Remove(name)
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package gee
+
+import "os"
+
+// reopenSignals 非类 Unix 系统没有 SIGUSR1, 需要调用 ReopenOnSignal 时指定信号
+var reopenSignals []os.Signal
@@ -0,0 +1,120 @@
+package gee
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotateWriterBySize(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewRotateWriter(RotateConfig{
+		Filename:   filepath.Join(dir, "access.log"),
+		MaxSize:    10,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 固定递增的时间, 保证旧文件名不同且有序
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		if _, err = w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	current, _ := os.ReadFile(filepath.Join(dir, "access.log"))
+	if string(current) != "line-4\n" {
+		t.Fatalf("current file = %q", current)
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "access-*.log.gz"))
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want 2 compressed files", backups)
+	}
+	// 保留的是最新的两个旧文件
+	if got := readGzip(t, backups[len(backups)-1]); got != "line-3\n" {
+		t.Fatalf("newest backup = %q", got)
+	}
+}
+
+func TestRotateWriterByAgeAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	w, err := NewRotateWriter(RotateConfig{Filename: name, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	now := time.Now()
+	w.now = func() time.Time { return now }
+
+	_, _ = w.Write([]byte("old\n"))
+	now = now.Add(time.Hour)
+	_, _ = w.Write([]byte("new\n"))
+	if backups, _ := filepath.Glob(filepath.Join(dir, "app-*.log")); len(backups) != 1 {
+		t.Fatalf("backups = %v, want 1", backups)
+	}
+
+	// 模拟 logrotate 移走文件之后重新打开
+	if err = os.Rename(name, name+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("reopened\n"))
+	if data, _ := os.ReadFile(name); string(data) != "reopened\n" {
+		t.Fatalf("reopened file = %q", data)
+	}
+}
+
+func TestRotateWriterConcurrent(t *testing.T) {
+	w, err := NewRotateWriter(RotateConfig{Filename: filepath.Join(t.TempDir(), "c.log"), MaxSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, _ = w.Write([]byte(strings.Repeat("x", 15) + "\n"))
+			}
+		}()
+	}
+	wg.Wait()
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readGzip(t *testing.T, name string) string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(gz)
+	return string(data)
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package gee
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals ReopenOnSignal 默认监听的信号
+var reopenSignals = []os.Signal{syscall.SIGUSR1}
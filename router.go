@@ -82,6 +82,7 @@ func (r *router) handle(ctx *Context) {
 	n, mapper := r.findRouter(ctx.Method, ctx.Path)
 	if n != nil {
 		ctx.Params = mapper
+		ctx.fullPath = n.pattern
 		key := ctx.Method + "-" + n.pattern
 		ctx.handlers = append(ctx.handlers, r.handlers[key]...)
 	} else {
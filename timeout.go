@@ -0,0 +1,201 @@
+package gee
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TimeoutConfig 超时中间件的配置
+type TimeoutConfig struct {
+	// Timeout 处理链的最长执行时间
+	Timeout time.Duration
+	// Handler 自定义超时响应, 为空时返回 503
+	Handler func(c *Context)
+}
+
+// Timeout 超时中间件, 使用默认的超时响应
+func Timeout(d time.Duration) HandlerFunc {
+	return TimeoutWithConfig(TimeoutConfig{Timeout: d})
+}
+
+// TimeoutWithConfig 根据配置创建超时中间件。
+// 后续的处理链在新的协程中使用 Context 的副本执行, 请求的上下文带有截止时间,
+// 响应先写入缓冲区, 按时完成时再写回; 超时之后处理函数的写入会返回 http.ErrHandlerTimeout,
+// 因此不会与超时响应冲突。处理链中的 panic 会在当前协程中重新抛出, 交给外层的 Recover 处理。
+// 由于响应被缓冲, 处理链中无法使用流式响应和 WebSocket
+func TimeoutWithConfig(conf TimeoutConfig) HandlerFunc {
+	if conf.Timeout <= 0 {
+		panic("[GEE] timeout must be positive")
+	}
+	return func(c *Context) {
+		ctx, cancel := newTimeoutContext(c.Req.Context(), conf.Timeout)
+		defer cancel()
+		timer := time.NewTimer(conf.Timeout)
+		defer timer.Stop()
+
+		tw := &timeoutWriter{h: c.Writer.Header().Clone()}
+		cp := c.Copy()
+		cp.Req = c.Req.WithContext(ctx)
+		cp.rw = newResponseWriter(tw)
+		cp.Writer = cp.rw
+		cp.handlers = c.handlers
+		cp.index = c.index
+		cp.forwards, cp.visited = c.forwards, c.visited
+
+		done, finished := make(chan struct{}), make(chan struct{})
+		panicCh := make(chan any, 1)
+		go func() {
+			defer close(finished)
+			defer func() {
+				if p := recover(); p != nil {
+					if tw.timeout() {
+						cp.log().Error("panic after timeout", "err", p, "path", cp.Path)
+						return
+					}
+					panicCh <- p
+				}
+			}()
+			cp.Next()
+			close(done)
+		}()
+
+		select {
+		case p := <-panicCh:
+			panic(p)
+		case <-done:
+			c.mu.Lock()
+			c.Keys = cp.Keys
+			c.mu.Unlock()
+			c.Params, c.fullPath = cp.Params, cp.fullPath
+			c.index = cp.index
+			// 处理链解析的表单保存在 cp.Req 中, 交还给 c.Req 之后由 http.Server 或者 Engine 清理临时文件
+			c.Req.Form, c.Req.PostForm, c.Req.MultipartForm = cp.Req.Form, cp.Req.PostForm, cp.Req.MultipartForm
+			tw.writeTo(c)
+		case <-timer.C:
+			// 先拒绝写入再结束上下文, 处理函数观察到超时时已经无法写回响应
+			tw.stop()
+			ctx.expired.Store(true)
+			cancel()
+			go removeMultipartForm(finished, cp.Req, c.Req.MultipartForm)
+			if conf.Handler != nil {
+				conf.Handler(c)
+				c.Abort()
+				return
+			}
+			c.AbortWithJson(http.StatusServiceUnavailable, "request timeout")
+		case <-ctx.Done():
+			// 客户端已经断开连接, 不需要再写回响应
+			tw.stop()
+			go removeMultipartForm(finished, cp.Req, c.Req.MultipartForm)
+			c.Abort()
+		}
+	}
+}
+
+// removeMultipartForm 超时之后处理链仍在执行, 等待它结束之后删除它解析的 multipart 表单的临时文件。
+// 与 shared 相同的表单在超时之前就已经解析, 由 http.Server 或者 Engine 清理
+func removeMultipartForm(finished <-chan struct{}, req *http.Request, shared *multipart.Form) {
+	<-finished
+	if req.MultipartForm != nil && req.MultipartForm != shared {
+		_ = req.MultipartForm.RemoveAll()
+	}
+}
+
+// timeoutContext 带有截止时间的请求上下文, 由超时中间件在拒绝写入之后结束,
+// 结束之后 Err 返回 context.DeadlineExceeded
+type timeoutContext struct {
+	context.Context
+	deadline time.Time
+	expired  atomic.Bool
+}
+
+func newTimeoutContext(parent context.Context, d time.Duration) (*timeoutContext, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	tc := &timeoutContext{Context: ctx, deadline: time.Now().Add(d)}
+	if pd, ok := parent.Deadline(); ok && pd.Before(tc.deadline) {
+		tc.deadline = pd
+	}
+	return tc, cancel
+}
+
+func (c *timeoutContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *timeoutContext) Err() error {
+	if c.expired.Load() {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
+
+// timeoutWriter 缓冲处理链写回的响应, 超时之后拒绝写入
+type timeoutWriter struct {
+	h http.Header
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+var _ http.ResponseWriter = &timeoutWriter{}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.h
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.status != 0 {
+		return
+	}
+	w.status = code
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.buf.Write(data)
+}
+
+func (w *timeoutWriter) stop() {
+	w.mu.Lock()
+	w.timedOut = true
+	w.mu.Unlock()
+}
+
+func (w *timeoutWriter) timeout() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.timedOut
+}
+
+// writeTo 将缓冲的响应头, 状态码和响应体写回 c, 处理链没有写回响应时不做任何事
+func (w *timeoutWriter) writeTo(c *Context) {
+	dst := c.Writer.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range w.h {
+		dst[k] = v
+	}
+	if w.status == 0 {
+		return
+	}
+	c.StatusCode = w.status
+	c.Writer.WriteHeader(w.status)
+	_, _ = c.Writer.Write(w.buf.Bytes())
+}
@@ -0,0 +1,131 @@
+package gee
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	lateErr := make(chan error, 1)
+	var upstream string
+	r := Default(WithReleaseMode(true), WithMiddlewares(Recover(), func(c *Context) {
+		c.Next()
+		upstream = c.GetString("user")
+	}, Timeout(50*time.Millisecond)))
+	r.GET("/fast", func(c *Context) {
+		if _, ok := c.Req.Context().Deadline(); !ok {
+			t.Error("request context should have a deadline")
+		}
+		c.Set("user", "gee")
+		c.Header("X-Handler", "fast")
+		c.String(http.StatusCreated, "done")
+	})
+	r.GET("/slow", func(c *Context) {
+		select {
+		case <-c.Req.Context().Done():
+		case <-time.After(time.Second):
+		}
+		if c.Req.Context().Err() != context.DeadlineExceeded {
+			t.Errorf("request context error = %v", c.Req.Context().Err())
+		}
+		c.Header("X-Handler", "slow")
+		_, err := c.Writer.Write([]byte("late"))
+		lateErr <- err
+	})
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if w.Code != http.StatusCreated || w.Body.String() != "done" || w.Header().Get("X-Handler") != "fast" {
+		t.Fatalf("fast handler response should be written back, status = %d, body = %q", w.Code, w.Body.String())
+	}
+	if upstream != "gee" {
+		t.Fatalf("keys should be visible to upstream middlewares, got %q", upstream)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("X-Handler") != "" {
+		t.Fatalf("slow handler should time out, status = %d, header = %v", w.Code, w.Header())
+	}
+	if err := <-lateErr; err != http.ErrHandlerTimeout {
+		t.Fatalf("late write should fail with ErrHandlerTimeout, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("panic should be handled by outer Recover, status = %d", w.Code)
+	}
+}
+
+func TestTimeoutWithConfigHandler(t *testing.T) {
+	r := Default(WithReleaseMode(true), WithMiddlewares(TimeoutWithConfig(TimeoutConfig{
+		Timeout: 10 * time.Millisecond,
+		Handler: func(c *Context) {
+			c.String(http.StatusGatewayTimeout, "too slow")
+		},
+	})))
+	r.GET("/slow", func(c *Context) {
+		<-c.Req.Context().Done()
+		c.String(http.StatusOK, "late")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusGatewayTimeout || w.Body.String() != "too slow" {
+		t.Fatalf("custom timeout response expected, status = %d, body = %q", w.Code, w.Body.String())
+	}
+}
+
+func TestTimeoutMultipartTempFilesRemoved(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	r := Default(WithMaxMultipartMemory(1), WithReleaseMode(true), WithMiddlewares(Timeout(200*time.Millisecond)))
+	upload := func(c *Context) {
+		if _, err := c.FormFile("file"); err != nil {
+			c.AbortWithJson(http.StatusBadRequest, err.Error())
+			return
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) == 0 {
+			t.Error("upload should spill to a temp file")
+		}
+	}
+	r.POST("/upload", func(c *Context) {
+		upload(c)
+		c.Status(http.StatusOK)
+	})
+	r.POST("/slow", func(c *Context) {
+		upload(c)
+		<-c.Req.Context().Done()
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	for path, code := range map[string]int{"/upload": http.StatusOK, "/slow": http.StatusServiceUnavailable} {
+		req := newUploadRequest(t, "file", "big.bin", strings.Repeat("x", 4<<10))
+		resp, err := http.Post(srv.URL+path, req.Header.Get("Content-Type"), req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Fatalf("%s status = %d, want %d", path, resp.StatusCode, code)
+		}
+		// 临时文件在响应写回之后才清理
+		deadline := time.Now().Add(2 * time.Second)
+		for entries, _ := os.ReadDir(dir); len(entries) != 0; entries, _ = os.ReadDir(dir) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: temp files should be removed after the request, got %d", path, len(entries))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package gee
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ws-cczj/gee/binding"
+	"net/http"
+	"reflect"
+)
+
+// HTTPError 携带状态码的错误, Typed 处理函数返回该错误时会使用其中的状态码写回响应
+type HTTPError struct {
+	Code    int
+	Message string
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+// NewHTTPError 创建一个携带状态码的错误, msg 为空时使用状态码对应的默认描述
+func NewHTTPError(code int, msg string) *HTTPError {
+	if msg == "" {
+		msg = http.StatusText(code)
+	}
+	return &HTTPError{Code: code, Message: msg}
+}
+
+// Typed 将一个普通函数适配为 HandlerFunc, T 必须为结构体或者结构体指针。
+// 请求依次从路径参数(uri 标签), 查询参数(form 标签)和请求体中绑定到 T 并使用 binding 标签校验,
+// 绑定或校验失败返回 400, 请求体过大返回 413。
+// fn 返回 *HTTPError 时使用其中的状态码, 其他错误返回 500, 成功时以 200 写回 Resp。
+// 如果 fn 中已经自行写回了响应, 则不会再次写回。
+// 校验使用 Typed 自己的校验器, 不会开启其他处理函数中 ShouldBind 的全局校验
+func Typed[T any, Resp any](fn func(c *Context, req T) (Resp, error)) HandlerFunc {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	isPtr := typ.Kind() == reflect.Ptr
+	if isPtr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("[GEE] Typed request type must be a struct or pointer to struct, got %s",
+			reflect.TypeOf((*T)(nil)).Elem()))
+	}
+	validator := binding.NewValidator()
+
+	return func(c *Context) {
+		var req T
+		var target any = &req
+		if isPtr {
+			req = reflect.New(typ).Interface().(T)
+			target = req
+		}
+		if err := bindTyped(c, target, validator); err != nil {
+			code := http.StatusBadRequest
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				code = http.StatusRequestEntityTooLarge
+			}
+			c.Abort()
+			c.renderJSON(code, H{"message": err.Error()})
+			return
+		}
+
+		resp, err := fn(c, req)
+		if err != nil {
+			code := http.StatusInternalServerError
+			var httpErr *HTTPError
+			if errors.As(err, &httpErr) {
+				code = httpErr.Code
+			}
+			c.Abort()
+			c.renderJSON(code, H{"message": err.Error()})
+			return
+		}
+		if c.StatusCode == 0 {
+			c.renderJSON(http.StatusOK, resp)
+		}
+	}
+}
+
+// bindTyped 按照 路径参数 -> 查询参数 -> 请求体 的顺序绑定 obj, 最后进行校验
+func bindTyped(c *Context, obj any, validator *binding.Validator) error {
+	if len(c.Params) > 0 {
+		if err := binding.BindUri(c.Params, obj); err != nil {
+			return err
+		}
+	}
+	if err := binding.BindQuery(c.Req, obj); err != nil {
+		return err
+	}
+	if c.Method != http.MethodGet && c.Method != http.MethodHead && c.Req.ContentLength != 0 {
+		if err := c.ShouldBind(obj); err != nil {
+			return err
+		}
+	}
+	return validator.ValidateStruct(obj)
+}
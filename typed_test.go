@@ -0,0 +1,120 @@
+package gee
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ws-cczj/gee/binding"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type createOrderReq struct {
+	UserID int    `uri:"uid"`
+	Source string `form:"source"`
+	Item   string `json:"item" binding:"required"`
+	Count  int    `json:"count" binding:"min=1"`
+}
+
+type createOrderResp struct {
+	UserID int    `json:"user_id"`
+	Source string `json:"source"`
+	Item   string `json:"item"`
+}
+
+func createOrder(c *Context, req createOrderReq) (createOrderResp, error) {
+	if req.Item == "forbidden" {
+		return createOrderResp{}, NewHTTPError(http.StatusForbidden, "")
+	}
+	if req.Item == "boom" {
+		return createOrderResp{}, errors.New("boom")
+	}
+	return createOrderResp{UserID: req.UserID, Source: req.Source, Item: req.Item}, nil
+}
+
+func TestTyped(t *testing.T) {
+	r := New()
+	r.POST("/users/:uid/orders", Typed(createOrder))
+
+	tests := []struct {
+		body string
+		code int
+		want string
+	}{
+		{`{"item":"book","count":1}`, http.StatusOK, `{"user_id":7,"source":"app","item":"book"}`},
+		{`{"count":1`, http.StatusBadRequest, `{"message":"unexpected EOF"}`},
+		{`{"item":"forbidden","count":1}`, http.StatusForbidden, `{"message":"Forbidden"}`},
+		{`{"item":"boom","count":1}`, http.StatusInternalServerError, `{"message":"boom"}`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/users/7/orders?source=app", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", binding.JSON)
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code || w.Body.String() != tt.want+"\n" {
+			t.Errorf("body %s: status = %d, resp = %s", tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	// 校验失败
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/users/7/orders", strings.NewReader(`{"item":"book","count":0}`))
+	req.Header.Set("Content-Type", binding.JSON)
+	r.ServeHTTP(w, req)
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); w.Code != http.StatusBadRequest || err != nil ||
+		!strings.Contains(body["message"], "min") {
+		t.Errorf("validation error: status = %d, resp = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTypedPointerRequest(t *testing.T) {
+	r := New()
+	r.POST("/users/:uid/orders", Typed(func(c *Context, req *createOrderReq) (createOrderResp, error) {
+		return createOrder(c, *req)
+	}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/users/3/orders", strings.NewReader(`{"item":"pen","count":2}`))
+	req.Header.Set("Content-Type", binding.JSON)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != `{"user_id":3,"source":"","item":"pen"}`+"\n" {
+		t.Fatalf("status = %d, resp = %s", w.Code, w.Body.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("non-struct request type should panic when building the handler")
+		}
+	}()
+	Typed(func(c *Context, req string) (string, error) { return req, nil })
+}
+
+func TestTypedKeepsGlobalValidationOff(t *testing.T) {
+	r := New()
+	r.POST("/typed", Typed(createOrder))
+	r.POST("/plain", func(c *Context) {
+		var req createOrderReq
+		if err := c.ShouldBind(&req); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/plain", strings.NewReader(`{"count":0}`))
+	req.Header.Set("Content-Type", binding.JSON)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("plain ShouldBind should not validate after a Typed route is built, status = %d, resp = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTypedHandlerIsPlainFunction(t *testing.T) {
+	resp, err := createOrder(nil, createOrderReq{UserID: 1, Item: "pen"})
+	if err != nil || resp.Item != "pen" {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+}
@@ -0,0 +1,525 @@
+package gee
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 消息类型, 与 RFC 6455 中的 opcode 一致
+const (
+	continuationFrame = 0
+	TextMessage       = 1
+	BinaryMessage     = 2
+	CloseMessage      = 8
+	PingMessage       = 9
+	PongMessage       = 10
+)
+
+// 关闭状态码, 参考 RFC 6455 7.4.1
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	websocketGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	defaultWSReadLimit    = 1 << 20 // 单条消息默认最大 1 MiB
+	maxControlPayloadSize = 125
+	finalBit              = 1 << 7
+	rsvBits               = 0x70
+	maskBit               = 1 << 7
+)
+
+var (
+	ErrBadHandshake  = errors.New("[GEE] websocket: bad handshake")
+	ErrBadOrigin     = errors.New("[GEE] websocket: request origin not allowed")
+	ErrNotHijacker   = errors.New("[GEE] response writer does not implement http.Hijacker")
+	ErrReadLimit     = errors.New("[GEE] websocket: read limit exceeded")
+	ErrCloseSent     = errors.New("[GEE] websocket: close sent")
+	ErrInvalidOpcode = errors.New("[GEE] websocket: invalid message type")
+	ErrControlTooBig = errors.New("[GEE] websocket: control frame payload too large")
+)
+
+// CloseError 对端发送关闭帧或者协议出错时返回的错误
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("[GEE] websocket: close %d %s", e.Code, e.Text)
+}
+
+// Upgrader 保存 WebSocket 握手的配置
+type Upgrader struct {
+	// CheckOrigin 校验请求的 Origin, 为 nil 时只允许没有 Origin 或者 Origin 与 Host 相同的请求
+	CheckOrigin func(r *http.Request) bool
+	// ReadLimit 单条消息(包含所有分片)的最大字节数, <= 0 时使用 defaultWSReadLimit
+	ReadLimit int64
+	// Subprotocols 服务端支持的子协议, 按照优先级排列
+	Subprotocols []string
+}
+
+// Upgrade 使用默认配置将当前请求升级为 WebSocket 连接
+func (c *Context) Upgrade() (*Conn, error) {
+	return (&Upgrader{}).Upgrade(c)
+}
+
+// Upgrade 完成 RFC 6455 握手并接管底层连接。握手失败时会写回对应的错误响应并终止处理链
+func (u *Upgrader) Upgrade(c *Context) (*Conn, error) {
+	r := c.Req
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		c.Header("Sec-WebSocket-Version", "13")
+		c.AbortWithStatus(http.StatusUpgradeRequired)
+		return nil, ErrBadHandshake
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = checkSameOrigin
+	}
+	if !checkOrigin(r) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return nil, ErrBadOrigin
+	}
+
+	hijacker, ok := c.Writer.(http.Hijacker)
+	if !ok {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, ErrNotHijacker
+	}
+	netConn, brw, err := hijacker.Hijack()
+	if err != nil {
+		if err == ErrNotHijacker {
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return nil, err
+	}
+
+	subprotocol := u.selectSubprotocol(r)
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	b.WriteString(computeAcceptKey(key))
+	if subprotocol != "" {
+		b.WriteString("\r\nSec-WebSocket-Protocol: ")
+		b.WriteString(subprotocol)
+	}
+	b.WriteString("\r\n\r\n")
+	if _, err = netConn.Write([]byte(b.String())); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	c.StatusCode = http.StatusSwitchingProtocols
+
+	conn := newConn(netConn, brw.Reader, true)
+	conn.subprotocol = subprotocol
+	if u.ReadLimit > 0 {
+		conn.readLimit = u.ReadLimit
+	}
+	return conn, nil
+}
+
+func (u *Upgrader) selectSubprotocol(r *http.Request) string {
+	for _, client := range headerTokens(r.Header, "Sec-WebSocket-Protocol") {
+		for _, server := range u.Subprotocols {
+			if client == server {
+				return server
+			}
+		}
+	}
+	return ""
+}
+
+// checkSameOrigin 没有 Origin 的请求不是来自浏览器, 直接放行; 否则要求 Origin 的 host 与请求的 Host 相同
+func checkSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func computeAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerTokens 将逗号分隔的请求头拆分为 token 列表
+func headerTokens(header http.Header, name string) (tokens []string) {
+	for _, v := range header.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, t := range headerTokens(header, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn WebSocket 连接。同一时刻只允许一个 goroutine 读取, 写入操作是并发安全的
+type Conn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	isServer bool // 服务端读取的帧必须带掩码, 写出的帧不带掩码; 客户端相反
+
+	subprotocol string
+	readLimit   int64
+	pongHandler func(data []byte)
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, isServer bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	return &Conn{
+		conn:      conn,
+		br:        br,
+		isServer:  isServer,
+		readLimit: defaultWSReadLimit,
+	}
+}
+
+// Subprotocol 返回握手时协商的子协议
+func (conn *Conn) Subprotocol() string {
+	return conn.subprotocol
+}
+
+// SetReadLimit 设置单条消息的最大字节数, 超出时发送 1009 关闭帧并返回 ErrReadLimit
+func (conn *Conn) SetReadLimit(limit int64) {
+	conn.readLimit = limit
+}
+
+// SetPongHandler 设置收到 pong 帧时的回调
+func (conn *Conn) SetPongHandler(h func(data []byte)) {
+	conn.pongHandler = h
+}
+
+func (conn *Conn) SetReadDeadline(t time.Time) error {
+	return conn.conn.SetReadDeadline(t)
+}
+
+func (conn *Conn) SetWriteDeadline(t time.Time) error {
+	return conn.conn.SetWriteDeadline(t)
+}
+
+func (conn *Conn) LocalAddr() net.Addr {
+	return conn.conn.LocalAddr()
+}
+
+func (conn *Conn) RemoteAddr() net.Addr {
+	return conn.conn.RemoteAddr()
+}
+
+// ReadMessage 读取一条完整的消息, 分片会被自动合并。
+// 读取过程中收到的 ping 会自动回复 pong, 收到关闭帧时会回复关闭帧并返回 *CloseError
+func (conn *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	for {
+		fin, opcode, payload, err := conn.readFrame(int64(len(p)))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err = conn.writeFrame(PongMessage, payload, true); err != nil && err != ErrCloseSent {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if conn.pongHandler != nil {
+				conn.pongHandler(payload)
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, conn.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, conn.failConnection(CloseProtocolError, "expected continuation frame")
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, conn.failConnection(CloseProtocolError, "unexpected continuation frame")
+			}
+		}
+
+		p = append(p, payload...)
+		if fin {
+			if messageType == TextMessage && !utf8.Valid(p) {
+				return 0, nil, conn.failConnection(CloseInvalidFramePayloadData, "invalid utf8 payload")
+			}
+			return messageType, p, nil
+		}
+	}
+}
+
+// readFrame 读取并校验一个帧, read 为当前消息中已经读取的字节数, 用于校验读取上限
+func (conn *Conn) readFrame(read int64) (fin bool, opcode int, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(conn.br, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&finalBit != 0
+	opcode = int(head[0] & 0x0f)
+	masked := head[1]&maskBit != 0
+	length := int64(head[1] & 0x7f)
+
+	if head[0]&rsvBits != 0 {
+		return fin, opcode, nil, conn.failConnection(CloseProtocolError, "unexpected reserved bits")
+	}
+	switch opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if !fin || length > maxControlPayloadSize {
+			return fin, opcode, nil, conn.failConnection(CloseProtocolError, "invalid control frame")
+		}
+	default:
+		return fin, opcode, nil, conn.failConnection(CloseProtocolError, "unknown opcode")
+	}
+	if masked != conn.isServer {
+		return fin, opcode, nil, conn.failConnection(CloseProtocolError, "invalid frame mask")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(conn.br, ext[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(conn.br, ext[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			return fin, opcode, nil, conn.failConnection(CloseProtocolError, "invalid payload length")
+		}
+	}
+
+	var maskKey [4]byte
+	if masked {
+		if _, err = io.ReadFull(conn.br, maskKey[:]); err != nil {
+			return
+		}
+	}
+
+	if opcode < CloseMessage && conn.readLimit > 0 && read+length > conn.readLimit {
+		_ = conn.failConnection(CloseMessageTooBig, "")
+		return fin, opcode, nil, ErrReadLimit
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(conn.br, payload); err != nil {
+		return
+	}
+	if masked {
+		maskBytes(maskKey, payload)
+	}
+	return
+}
+
+// handleClose 处理对端发送的关闭帧, 回复关闭帧后返回 *CloseError
+func (conn *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return conn.failConnection(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+		if !validCloseCode(closeErr.Code) || !utf8.Valid(payload[2:]) {
+			return conn.failConnection(CloseProtocolError, "invalid close payload")
+		}
+	}
+
+	var reply []byte
+	if closeErr.Code != CloseNoStatusReceived {
+		reply = formatCloseMessage(closeErr.Code, "")
+	}
+	if err := conn.writeFrame(CloseMessage, reply, true); err != nil && err != ErrCloseSent {
+		return err
+	}
+	return closeErr
+}
+
+// failConnection 因为协议错误发送关闭帧, 返回对应的 *CloseError
+func (conn *Conn) failConnection(code int, text string) error {
+	_ = conn.writeFrame(CloseMessage, formatCloseMessage(code, text), true)
+	return &CloseError{Code: code, Text: text}
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+func formatCloseMessage(code int, text string) []byte {
+	buf := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(buf, uint16(code))
+	copy(buf[2:], text)
+	return buf
+}
+
+// WriteMessage 将 data 作为一个完整的帧写出, messageType 为 TextMessage 或 BinaryMessage
+func (conn *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return ErrInvalidOpcode
+	}
+	return conn.writeFrame(messageType, data, true)
+}
+
+// WriteFragments 将多个分片作为一条消息写出, 写出期间其他数据帧不会穿插其中
+func (conn *Conn) WriteFragments(messageType int, fragments ...[]byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return ErrInvalidOpcode
+	}
+	if len(fragments) == 0 {
+		return conn.writeFrame(messageType, nil, true)
+	}
+
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
+	opcode := messageType
+	for i, fragment := range fragments {
+		if err := conn.writeFrameLocked(opcode, fragment, i == len(fragments)-1); err != nil {
+			return err
+		}
+		opcode = continuationFrame
+	}
+	return nil
+}
+
+// Ping 发送 ping 帧, 对端回复的 pong 会交给 SetPongHandler 设置的回调处理
+func (conn *Conn) Ping(data []byte) error {
+	if len(data) > maxControlPayloadSize {
+		return ErrControlTooBig
+	}
+	return conn.writeFrame(PingMessage, data, true)
+}
+
+// WriteClose 发送关闭帧开始关闭握手, 之后继续调用 ReadMessage 直到返回 *CloseError 再调用 Close
+func (conn *Conn) WriteClose(code int, text string) error {
+	var payload []byte
+	if code != CloseNoStatusReceived {
+		payload = formatCloseMessage(code, text)
+	}
+	return conn.writeFrame(CloseMessage, payload, true)
+}
+
+// Close 关闭底层连接, 如果还没有发送关闭帧则先发送 1000 关闭帧
+func (conn *Conn) Close() error {
+	_ = conn.WriteClose(CloseNormalClosure, "")
+	return conn.conn.Close()
+}
+
+func (conn *Conn) writeFrame(opcode int, payload []byte, fin bool) error {
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
+	return conn.writeFrameLocked(opcode, payload, fin)
+}
+
+// writeFrameLocked 组装并写出一个帧, 调用方需要持有 writeMu
+func (conn *Conn) writeFrameLocked(opcode int, payload []byte, fin bool) error {
+	if conn.closeSent {
+		return ErrCloseSent
+	}
+	if opcode == CloseMessage {
+		conn.closeSent = true
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	b0 := byte(opcode)
+	if fin {
+		b0 |= finalBit
+	}
+	frame = append(frame, b0)
+
+	var b1 byte
+	if !conn.isServer {
+		b1 = maskBit
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, b1|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, b1|126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, b1|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if conn.isServer {
+		frame = append(frame, payload...)
+	} else {
+		var maskKey [4]byte
+		if _, err := rand.Read(maskKey[:]); err != nil {
+			return err
+		}
+		frame = append(frame, maskKey[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(maskKey, frame[start:])
+	}
+	_, err := conn.conn.Write(frame)
+	return err
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
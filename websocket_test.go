@@ -0,0 +1,172 @@
+package gee
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialWebSocket 在测试中充当客户端, 手动完成握手后复用 Conn 的客户端模式
+func dialWebSocket(t *testing.T, srv *httptest.Server, path string, header http.Header) (*Conn, *http.Response) {
+	t.Helper()
+	netConn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err = req.Write(netConn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		_ = netConn.Close()
+		return nil, resp
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("accept key = %q", got)
+	}
+	conn := newConn(netConn, br, false)
+	t.Cleanup(func() { _ = netConn.Close() })
+	return conn, resp
+}
+
+func newWebSocketServer(t *testing.T, u *Upgrader) *httptest.Server {
+	r := New()
+	r.GET("/ws", func(c *Context) {
+		conn, err := u.Upgrade(c)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = conn.WriteMessage(mt, p); err != nil {
+				return
+			}
+		}
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	srv := newWebSocketServer(t, &Upgrader{})
+	conn, _ := dialWebSocket(t, srv, "/ws", nil)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := conn.WriteMessage(TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	mt, p, err := conn.ReadMessage()
+	if err != nil || mt != TextMessage || string(p) != "hello" {
+		t.Fatalf("mt = %d, p = %q, err = %v", mt, p, err)
+	}
+
+	big := bytes.Repeat([]byte{0xff}, 70000)
+	if err = conn.WriteMessage(BinaryMessage, big); err != nil {
+		t.Fatal(err)
+	}
+	mt, p, err = conn.ReadMessage()
+	if err != nil || mt != BinaryMessage || !bytes.Equal(p, big) {
+		t.Fatalf("binary echo failed: mt = %d, len = %d, err = %v", mt, len(p), err)
+	}
+
+	if err = conn.WriteFragments(TextMessage, []byte("frag"), []byte("men"), []byte("ted")); err != nil {
+		t.Fatal(err)
+	}
+	if _, p, err = conn.ReadMessage(); err != nil || string(p) != "fragmented" {
+		t.Fatalf("p = %q, err = %v", p, err)
+	}
+}
+
+func TestWebSocketPingPongAndClose(t *testing.T) {
+	srv := newWebSocketServer(t, &Upgrader{})
+	conn, _ := dialWebSocket(t, srv, "/ws", nil)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	pong := make(chan string, 1)
+	conn.SetPongHandler(func(data []byte) { pong <- string(data) })
+	if err := conn.Ping([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.WriteMessage(TextMessage, []byte("after ping"))
+	if _, p, err := conn.ReadMessage(); err != nil || string(p) != "after ping" {
+		t.Fatalf("p = %q, err = %v", p, err)
+	}
+	select {
+	case data := <-pong:
+		if data != "ping" {
+			t.Fatalf("pong payload = %q", data)
+		}
+	default:
+		t.Fatal("pong handler should be called")
+	}
+
+	if err := conn.WriteClose(CloseNormalClosure, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := conn.ReadMessage()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseNormalClosure {
+		t.Fatalf("err = %v, want close 1000", err)
+	}
+}
+
+func TestWebSocketReadLimit(t *testing.T) {
+	srv := newWebSocketServer(t, &Upgrader{ReadLimit: 8})
+	conn, _ := dialWebSocket(t, srv, "/ws", nil)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// 分片的总长度同样受到限制
+	_ = conn.WriteFragments(TextMessage, []byte("12345"), []byte("67890"))
+	_, _, err := conn.ReadMessage()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseMessageTooBig {
+		t.Fatalf("err = %v, want close 1009", err)
+	}
+}
+
+func TestWebSocketHandshakeRejected(t *testing.T) {
+	srv := newWebSocketServer(t, &Upgrader{})
+	conn, resp := dialWebSocket(t, srv, "/ws", http.Header{"Origin": {"http://evil.example.com"}})
+	if conn != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("cross origin request should be rejected, status = %d", resp.StatusCode)
+	}
+
+	allowed := newWebSocketServer(t, &Upgrader{CheckOrigin: func(r *http.Request) bool {
+		return strings.HasSuffix(r.Header.Get("Origin"), ".example.com")
+	}})
+	if conn, _ = dialWebSocket(t, allowed, "/ws", http.Header{"Origin": {"http://app.example.com"}}); conn == nil {
+		t.Fatal("origin allowed by CheckOrigin should be accepted")
+	}
+
+	resp, err := http.Get(srv.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain request status = %d, want 400", resp.StatusCode)
+	}
+}